@@ -0,0 +1,76 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// bulkInstaller is implemented by services whose manager must be reloaded
+// after their configuration changes, so that many of them can be installed
+// with a single reload.
+type bulkInstaller interface {
+	install(reload bool) error
+	DaemonReload() error
+	reloadScope() string
+}
+
+// reloadOnce reloads each distinct manager of the services once.
+func reloadOnce(services []Service) error {
+	done := make(map[string]bool)
+	for _, s := range services {
+		b, ok := s.(bulkInstaller)
+		if !ok || done[b.reloadScope()] {
+			continue
+		}
+		done[b.reloadScope()] = true
+		if err := b.DaemonReload(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InstallAll installs the services, reloading each service manager once at
+// the end rather than after every service. If a service fails to install,
+// the services installed before it are uninstalled again and the error names
+// the failing service.
+func InstallAll(services []Service) error {
+	for i, s := range services {
+		var err error
+		if b, ok := s.(bulkInstaller); ok {
+			err = b.install(false)
+		} else {
+			err = s.Install()
+		}
+		if err != nil {
+			for j := i - 1; j >= 0; j-- {
+				services[j].Uninstall()
+			}
+			reloadOnce(services[:i])
+			return fmt.Errorf("Failed to install %v: %v", s, err)
+		}
+	}
+	return reloadOnce(services)
+}
+
+// UninstallAll uninstalls the services and then reloads each service manager
+// once. It continues past failures and reports every service that failed.
+func UninstallAll(services []Service) error {
+	var failed []string
+	for _, s := range services {
+		if err := s.Uninstall(); err != nil {
+			failed = append(failed, fmt.Sprintf("%v: %v", s, err))
+		}
+	}
+	if err := reloadOnce(services); err != nil {
+		failed = append(failed, err.Error())
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Failed to uninstall %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+// bulkService records installs and reloads of a service managed by scope.
+type bulkService struct {
+	controlService
+	scope     string
+	installed bool
+	reloads   *int
+}
+
+func (s *bulkService) install(reload bool) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.installed = true
+	return nil
+}
+func (s *bulkService) Uninstall() error    { s.installed = false; return nil }
+func (s *bulkService) DaemonReload() error { *s.reloads++; return nil }
+func (s *bulkService) reloadScope() string { return s.scope }
+
+func TestInstallAll(t *testing.T) {
+	var reloads int
+	a := &bulkService{scope: "system", reloads: &reloads}
+	b := &bulkService{scope: "system", reloads: &reloads}
+	c := &bulkService{scope: "user", reloads: &reloads}
+	if err := InstallAll([]Service{a, b, c}); err != nil {
+		t.Fatal(err)
+	}
+	if !a.installed || !b.installed || !c.installed {
+		t.Error("InstallAll did not install every service")
+	}
+	if reloads != 2 {
+		t.Errorf("InstallAll reloaded %d times, want once per scope", reloads)
+	}
+
+	reloads = 0
+	a.installed, b.installed = false, false
+	c.err = errors.New("boom")
+	if err := InstallAll([]Service{a, b, c}); err == nil {
+		t.Error("InstallAll want error, got nil")
+	}
+	if a.installed || b.installed {
+		t.Error("InstallAll did not roll back after a failure")
+	}
+}
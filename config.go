@@ -0,0 +1,406 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+// NewConfig returns a Config for the named service. The With methods set the
+// fields and system specific options of the Config and return it, so calls
+// can be chained:
+//
+//	c := service.NewConfig("app").WithReloadSignal("HUP").WithRestart(service.RestartOnFailure)
+//
+// Options set this way are stored in Config.Option under their documented names.
+func NewConfig(name string) *Config {
+	return &Config{Name: name, Option: KeyValue{}}
+}
+
+// Clone returns a copy of the Config that can be changed without affecting
+// it, such as to install many services that differ only by UserName:
+//
+//	for _, user := range users {
+//		s, err := service.New(p, c.Clone().WithUserName(user))
+//		...
+//	}
+//
+// The Option and EnvVars maps, the slices and the []string option values are
+// copied; other option values, HealthCheck and Logger are shared.
+func (c *Config) Clone() *Config {
+	n := *c
+	n.Arguments = append([]string(nil), c.Arguments...)
+	n.Dependencies = append([]string(nil), c.Dependencies...)
+	n.Conflicts = append([]string(nil), c.Conflicts...)
+	n.Before = append([]string(nil), c.Before...)
+	n.Sockets = append([]SocketConfig(nil), c.Sockets...)
+	n.Documentation = append([]string(nil), c.Documentation...)
+	n.ExecStop = append([]string(nil), c.ExecStop...)
+	if c.ExecStartExtra != nil {
+		n.ExecStartExtra = make([][]string, len(c.ExecStartExtra))
+		for i, command := range c.ExecStartExtra {
+			n.ExecStartExtra[i] = append([]string(nil), command...)
+		}
+	}
+	if c.EnvVars != nil {
+		n.EnvVars = make(map[string]string, len(c.EnvVars))
+		for k, v := range c.EnvVars {
+			n.EnvVars[k] = v
+		}
+	}
+	if c.Option != nil {
+		n.Option = make(KeyValue, len(c.Option))
+		for k, v := range c.Option {
+			if list, ok := v.([]string); ok {
+				v = append([]string(nil), list...)
+			}
+			n.Option[k] = v
+		}
+	}
+	return &n
+}
+
+// set stores an option, creating the Option map if needed.
+func (c *Config) set(name string, value interface{}) *Config {
+	if c.Option == nil {
+		c.Option = KeyValue{}
+	}
+	c.Option[name] = value
+	return c
+}
+
+// WithDisplayName sets DisplayName.
+func (c *Config) WithDisplayName(name string) *Config {
+	c.DisplayName = name
+	return c
+}
+
+// WithDescription sets Description.
+func (c *Config) WithDescription(description string) *Config {
+	c.Description = description
+	return c
+}
+
+// WithUserName sets UserName.
+func (c *Config) WithUserName(name string) *Config {
+	c.UserName = name
+	return c
+}
+
+// WithArguments sets Arguments.
+func (c *Config) WithArguments(args ...string) *Config {
+	c.Arguments = args
+	return c
+}
+
+// WithConflicts sets Conflicts.
+func (c *Config) WithConflicts(units ...string) *Config {
+	c.Conflicts = units
+	return c
+}
+
+// WithBefore sets Before.
+func (c *Config) WithBefore(units ...string) *Config {
+	c.Before = units
+	return c
+}
+
+// WithSockets sets Sockets.
+func (c *Config) WithSockets(sockets ...SocketConfig) *Config {
+	c.Sockets = sockets
+	return c
+}
+
+// WithExecutable sets Executable.
+func (c *Config) WithExecutable(path string) *Config {
+	c.Executable = path
+	return c
+}
+
+// WithWorkingDirectory sets WorkingDirectory.
+func (c *Config) WithWorkingDirectory(dir string) *Config {
+	c.WorkingDirectory = dir
+	return c
+}
+
+// WithEnvVars sets EnvVars.
+func (c *Config) WithEnvVars(env map[string]string) *Config {
+	c.EnvVars = env
+	return c
+}
+
+// WithRestart sets Restart.
+func (c *Config) WithRestart(policy RestartPolicy) *Config {
+	c.Restart = policy
+	return c
+}
+
+// WithKeepAlive sets the OS X KeepAlive option.
+func (c *Config) WithKeepAlive(keepAlive bool) *Config {
+	return c.set(optionKeepAlive, keepAlive)
+}
+
+// WithRunAtLoad sets the OS X RunAtLoad option.
+func (c *Config) WithRunAtLoad(runAtLoad bool) *Config {
+	return c.set(optionRunAtLoad, runAtLoad)
+}
+
+// WithSessionCreate sets the OS X SessionCreate option.
+func (c *Config) WithSessionCreate(create bool) *Config {
+	return c.set(optionSessionCreate, create)
+}
+
+// WithUserService sets the UserService option.
+func (c *Config) WithUserService(user bool) *Config {
+	return c.set(optionUserService, user)
+}
+
+// WithManagerScope sets the systemd ManagerScope option.
+func (c *Config) WithManagerScope(scope string) *Config {
+	return c.set(optionManagerScope, scope)
+}
+
+// WithRestoreCon sets the Linux RestoreCon option.
+func (c *Config) WithRestoreCon(restore bool) *Config {
+	return c.set(optionRestoreCon, restore)
+}
+
+// WithAliases sets the systemd Aliases option.
+func (c *Config) WithAliases(aliases ...string) *Config {
+	return c.set(optionAliases, aliases)
+}
+
+// WithNativeRestart sets the systemd Restart option, used when Restart is unset.
+func (c *Config) WithNativeRestart(restart string) *Config {
+	return c.set(optionRestart, restart)
+}
+
+// WithWatchdogSec sets the systemd WatchdogSec option.
+func (c *Config) WithWatchdogSec(timeout string) *Config {
+	return c.set(optionWatchdogSec, timeout)
+}
+
+// WithAutoEnable sets the systemd AutoEnable option.
+func (c *Config) WithAutoEnable(enable bool) *Config {
+	return c.set(optionAutoEnable, enable)
+}
+
+// WithUnitDir sets the systemd UnitDir option.
+func (c *Config) WithUnitDir(dir string) *Config {
+	return c.set(optionUnitDir, dir)
+}
+
+// WithSkipDaemonReload sets the systemd SkipDaemonReload option.
+func (c *Config) WithSkipDaemonReload(skip bool) *Config {
+	return c.set(optionSkipDaemonReload, skip)
+}
+
+// WithRespawnLimit sets the Upstart RespawnCount and RespawnInterval options.
+func (c *Config) WithRespawnLimit(count, interval int) *Config {
+	c.set(optionRespawnCount, count)
+	return c.set(optionRespawnInterval, interval)
+}
+
+// WithOOMScoreAdjust sets the Linux OOMScoreAdjust option.
+func (c *Config) WithOOMScoreAdjust(adjust int) *Config {
+	return c.set(optionOOMScoreAdjust, adjust)
+}
+
+// WithRestartWait sets the systemd RestartWait option.
+func (c *Config) WithRestartWait(wait string) *Config {
+	return c.set(optionRestartWait, wait)
+}
+
+// WithRawWorkingDirectory sets the systemd RawWorkingDirectory option.
+func (c *Config) WithRawWorkingDirectory(raw bool) *Config {
+	return c.set(optionRawWorkingDirectory, raw)
+}
+
+// WithProcessTitle sets the systemd ProcessTitle option.
+func (c *Config) WithProcessTitle(title string) *Config {
+	return c.set(optionProcessTitle, title)
+}
+
+// WithCapabilities sets the systemd AmbientCapabilities and
+// CapabilityBoundingSet options.
+func (c *Config) WithCapabilities(ambient, bounding []string) *Config {
+	c.set(optionAmbientCapabilities, ambient)
+	return c.set(optionCapabilityBoundingSet, bounding)
+}
+
+// WithSELinuxContext sets the systemd SELinuxContext option.
+func (c *Config) WithSELinuxContext(context string) *Config {
+	return c.set(optionSELinuxContext, context)
+}
+
+// WithAppArmorProfile sets the systemd AppArmorProfile option.
+func (c *Config) WithAppArmorProfile(profile string) *Config {
+	return c.set(optionAppArmorProfile, profile)
+}
+
+// WithStartOn sets the Upstart StartOn and StopOn options.
+func (c *Config) WithStartOn(startOn, stopOn string) *Config {
+	c.set(optionStartOn, startOn)
+	return c.set(optionStopOn, stopOn)
+}
+
+// WithExpect sets the Upstart Expect option.
+func (c *Config) WithExpect(expect string) *Config {
+	return c.set(optionExpect, expect)
+}
+
+// WithEmits sets the Upstart Emits option.
+func (c *Config) WithEmits(events ...string) *Config {
+	return c.set(optionEmits, events)
+}
+
+// WithSuccessExitStatus sets the systemd SuccessExitStatus option.
+func (c *Config) WithSuccessExitStatus(status string) *Config {
+	return c.set(optionSuccessExitStatus, status)
+}
+
+// WithKeepFile sets the systemd KeepFile option.
+func (c *Config) WithKeepFile(keep bool) *Config {
+	return c.set(optionKeepFile, keep)
+}
+
+// WithTasksMax sets the systemd TasksMax option.
+func (c *Config) WithTasksMax(max int) *Config {
+	return c.set(optionTasksMax, max)
+}
+
+// WithCopyToPath sets the POSIX CopyToPath option.
+func (c *Config) WithCopyToPath(path string) *Config {
+	return c.set(optionCopyToPath, path)
+}
+
+// WithSlice sets the systemd Slice option.
+func (c *Config) WithSlice(slice string) *Config {
+	return c.set(optionSlice, slice)
+}
+
+// WithAccounting sets the systemd EnableAccounting option.
+func (c *Config) WithAccounting(enable bool) *Config {
+	return c.set(optionEnableAccounting, enable)
+}
+
+// WithTargetRoot sets the systemd TargetRoot option.
+func (c *Config) WithTargetRoot(root string) *Config {
+	return c.set(optionTargetRoot, root)
+}
+
+// WithBusName sets the systemd BusName option.
+func (c *Config) WithBusName(name string) *Config {
+	return c.set(optionBusName, name)
+}
+
+// WithUMask sets the Linux UMask option.
+func (c *Config) WithUMask(mask string) *Config {
+	return c.set(optionUMask, mask)
+}
+
+// WithKillMode sets the systemd KillMode option.
+func (c *Config) WithKillMode(mode string) *Config {
+	return c.set(optionKillMode, mode)
+}
+
+// WithHardeningProfile sets the systemd HardeningProfile option.
+func (c *Config) WithHardeningProfile(profile string) *Config {
+	return c.set(optionHardeningProfile, profile)
+}
+
+// WithShellWrap sets the systemd ShellWrap option.
+func (c *Config) WithShellWrap(wrap bool) *Config {
+	return c.set(optionShellWrap, wrap)
+}
+
+// WithShellSyntax sets the systemd ShellSyntax option, which needs ShellWrap.
+func (c *Config) WithShellSyntax(syntax string) *Config {
+	return c.set(optionShellSyntax, syntax)
+}
+
+// WithGroupName sets the systemd GroupName option.
+func (c *Config) WithGroupName(name string) *Config {
+	return c.set(optionGroupName, name)
+}
+
+// WithType sets the systemd Type option.
+func (c *Config) WithType(serviceType string) *Config {
+	return c.set(optionServiceType, serviceType)
+}
+
+// WithRemainAfterExit sets the systemd RemainAfterExit option.
+func (c *Config) WithRemainAfterExit(remain bool) *Config {
+	return c.set(optionRemainAfterExit, remain)
+}
+
+// WithConditionVirtualization sets the systemd ConditionVirtualization option.
+func (c *Config) WithConditionVirtualization(condition string) *Config {
+	return c.set(optionConditionVirtualization, condition)
+}
+
+// WithConditionHost sets the systemd ConditionHost option.
+func (c *Config) WithConditionHost(condition string) *Config {
+	return c.set(optionConditionHost, condition)
+}
+
+// WithAssertPathExists sets the systemd AssertPathExists option.
+func (c *Config) WithAssertPathExists(paths ...string) *Config {
+	return c.set(optionAssertPathExists, paths)
+}
+
+// WithRequiresMountsFor sets the systemd RequiresMountsFor option.
+func (c *Config) WithRequiresMountsFor(paths ...string) *Config {
+	return c.set(optionRequiresMountsFor, paths)
+}
+
+// WithUnitRaw sets the systemd UnitRaw option.
+func (c *Config) WithUnitRaw(lines ...string) *Config {
+	return c.set(optionUnitRaw, lines)
+}
+
+// WithServiceRaw sets the systemd ServiceRaw option.
+func (c *Config) WithServiceRaw(lines ...string) *Config {
+	return c.set(optionServiceRaw, lines)
+}
+
+// WithInstallRaw sets the systemd InstallRaw option.
+func (c *Config) WithInstallRaw(lines ...string) *Config {
+	return c.set(optionInstallRaw, lines)
+}
+
+// WithRecovery sets the Windows RecoveryRestartCount, RecoveryRestartDelay
+// and RecoveryResetPeriod options.
+func (c *Config) WithRecovery(count int, delay string, resetPeriod int) *Config {
+	c.set(optionRecoveryRestartCount, count)
+	c.set(optionRecoveryRestartDelay, delay)
+	return c.set(optionRecoveryResetPeriod, resetPeriod)
+}
+
+// WithRunWait sets the POSIX RunWait option.
+func (c *Config) WithRunWait(wait func()) *Config {
+	return c.set(optionRunWait, wait)
+}
+
+// WithReloadSignal sets the POSIX ReloadSignal option.
+func (c *Config) WithReloadSignal(signal string) *Config {
+	return c.set(optionReloadSignal, signal)
+}
+
+// WithPIDFile sets the POSIX PIDFile option.
+func (c *Config) WithPIDFile(path string) *Config {
+	return c.set(optionPIDFile, path)
+}
+
+// WithReloadPIDFile sets the POSIX ReloadPIDFile option.
+func (c *Config) WithReloadPIDFile(reload bool) *Config {
+	return c.set(optionReloadPIDFile, reload)
+}
+
+// WithForce sets the POSIX Force option.
+func (c *Config) WithForce(force bool) *Config {
+	return c.set(optionForce, force)
+}
+
+// WithSkipPathCheck sets the POSIX SkipPathCheck option.
+func (c *Config) WithSkipPathCheck(skip bool) *Config {
+	return c.set(optionSkipPathCheck, skip)
+}
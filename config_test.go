@@ -0,0 +1,94 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfigBuilder(t *testing.T) {
+	c := NewConfig("app").
+		WithReloadSignal("HUP").
+		WithPIDFile("/run/app.pid").
+		WithRestart(RestartOnFailure).
+		WithAliases("app-alias").
+		WithRespawnLimit(3, 60)
+
+	if c.Name != "app" || c.Restart != RestartOnFailure {
+		t.Errorf("NewConfig fields = %q, %v", c.Name, c.Restart)
+	}
+	if got := c.Option.string(optionReloadSignal, ""); got != "HUP" {
+		t.Errorf("ReloadSignal = %q", got)
+	}
+	if got := c.Option.string(optionPIDFile, ""); got != "/run/app.pid" {
+		t.Errorf("PIDFile = %q", got)
+	}
+	if got := c.Option.stringSlice(optionAliases, nil); len(got) != 1 || got[0] != "app-alias" {
+		t.Errorf("Aliases = %q", got)
+	}
+	if got := c.Option.int(optionRespawnCount, 0); got != 3 {
+		t.Errorf("RespawnCount = %d", got)
+	}
+
+	// A Config built as a literal without an Option map gets one.
+	c = (&Config{Name: "app"}).WithForce(true)
+	if !c.Option.bool(optionForce, false) {
+		t.Error("WithForce did not set the Force option")
+	}
+}
+
+func TestConfigBuilderCoversFileOptions(t *testing.T) {
+	// Options set together, or by a setter named after their purpose.
+	setters := map[string]string{
+		optionRestart:               "WithNativeRestart",
+		optionRespawnCount:          "WithRespawnLimit",
+		optionRespawnInterval:       "WithRespawnLimit",
+		optionStartOn:               "WithStartOn",
+		optionStopOn:                "WithStartOn",
+		optionAmbientCapabilities:   "WithCapabilities",
+		optionCapabilityBoundingSet: "WithCapabilities",
+		optionEnableAccounting:      "WithAccounting",
+		optionServiceType:           "WithType",
+		optionRecoveryRestartCount:  "WithRecovery",
+		optionRecoveryRestartDelay:  "WithRecovery",
+		optionRecoveryResetPeriod:   "WithRecovery",
+	}
+	typ := reflect.TypeOf(&Config{})
+	for name := range fileOptions {
+		setter, found := setters[name]
+		if !found {
+			setter = "With" + name
+		}
+		if _, found = typ.MethodByName(setter); !found {
+			t.Errorf("option %s has no %s setter", name, setter)
+		}
+	}
+}
+
+func TestConfigClone(t *testing.T) {
+	c := NewConfig("app").WithUserName("alice").WithArguments("-v").WithEnvVars(map[string]string{"A": "1"}).
+		WithAliases("app-alias")
+	c.ExecStartExtra = [][]string{{"/usr/bin/migrate"}}
+	n := c.Clone().WithUserName("bob").WithForce(true)
+	n.Arguments[0] = "-q"
+	n.EnvVars["A"] = "2"
+	n.ExecStartExtra[0][0] = "/usr/bin/seed"
+	n.Option.stringSlice(optionAliases, nil)[0] = "bob-alias"
+
+	if c.UserName != "alice" || n.UserName != "bob" {
+		t.Errorf("UserName = %q, clone %q", c.UserName, n.UserName)
+	}
+	if c.Option.bool(optionForce, false) {
+		t.Error("setting an option on the clone changed the original")
+	}
+	if c.Arguments[0] != "-v" || c.EnvVars["A"] != "1" {
+		t.Errorf("changing the clone changed the original: %q, %v", c.Arguments, c.EnvVars)
+	}
+	if c.ExecStartExtra[0][0] != "/usr/bin/migrate" || c.Option.stringSlice(optionAliases, nil)[0] != "app-alias" {
+		t.Errorf("changing the clone changed the original: %q, %q",
+			c.ExecStartExtra, c.Option.stringSlice(optionAliases, nil))
+	}
+}
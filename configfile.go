@@ -0,0 +1,237 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// optionKind is the type of the value an option holds.
+type optionKind int
+
+const (
+	optionKindString optionKind = iota
+	optionKindBool
+	optionKindInt
+	optionKindStrings
+)
+
+// fileOptions lists the options that can be set in an [Option] section of a
+// config file, with the type of their value.
+var fileOptions = map[string]optionKind{
+	optionKeepAlive:               optionKindBool,
+	optionRunAtLoad:               optionKindBool,
+	optionUserService:             optionKindBool,
+	optionSessionCreate:           optionKindBool,
+	optionManagerScope:            optionKindString,
+	optionRestoreCon:              optionKindBool,
+	optionOOMScoreAdjust:          optionKindInt,
+	optionUMask:                   optionKindString,
+	optionAliases:                 optionKindStrings,
+	optionRestart:                 optionKindString,
+	optionWatchdogSec:             optionKindString,
+	optionRestartWait:             optionKindString,
+	optionAutoEnable:              optionKindBool,
+	optionUnitDir:                 optionKindString,
+	optionSkipDaemonReload:        optionKindBool,
+	optionTargetRoot:              optionKindString,
+	optionKeepFile:                optionKindBool,
+	optionRespawnCount:            optionKindInt,
+	optionRespawnInterval:         optionKindInt,
+	optionExpect:                  optionKindString,
+	optionStartOn:                 optionKindString,
+	optionStopOn:                  optionKindString,
+	optionEmits:                   optionKindStrings,
+	optionKillMode:                optionKindString,
+	optionSuccessExitStatus:       optionKindString,
+	optionTasksMax:                optionKindInt,
+	optionSlice:                   optionKindString,
+	optionEnableAccounting:        optionKindBool,
+	optionHardeningProfile:        optionKindString,
+	optionShellWrap:               optionKindBool,
+	optionShellSyntax:             optionKindString,
+	optionProcessTitle:            optionKindString,
+	optionAmbientCapabilities:     optionKindStrings,
+	optionCapabilityBoundingSet:   optionKindStrings,
+	optionSELinuxContext:          optionKindString,
+	optionAppArmorProfile:         optionKindString,
+	optionGroupName:               optionKindString,
+	optionServiceType:             optionKindString,
+	optionBusName:                 optionKindString,
+	optionRemainAfterExit:         optionKindBool,
+	optionConditionVirtualization: optionKindString,
+	optionConditionHost:           optionKindString,
+	optionAssertPathExists:        optionKindStrings,
+	optionRequiresMountsFor:       optionKindStrings,
+	optionUnitRaw:                 optionKindStrings,
+	optionServiceRaw:              optionKindStrings,
+	optionInstallRaw:              optionKindStrings,
+	optionRawWorkingDirectory:     optionKindBool,
+	optionRecoveryRestartCount:    optionKindInt,
+	optionRecoveryRestartDelay:    optionKindString,
+	optionRecoveryResetPeriod:     optionKindInt,
+	optionReloadSignal:            optionKindString,
+	optionPIDFile:                 optionKindString,
+	optionForce:                   optionKindBool,
+	optionCopyToPath:              optionKindString,
+	optionSkipPathCheck:           optionKindBool,
+	optionReloadPIDFile:           optionKindBool,
+}
+
+// LoadConfig reads a Config from the INI file at path. The [Service] section
+// sets the Config fields by name, the [Option] section the system specific
+// options documented on Config.Option and the [Environment] section EnvVars:
+//
+//	[Service]
+//	Name = app
+//	Description = My application.
+//	Arguments = -config
+//	Arguments = /etc/app.conf
+//
+//	[Option]
+//	ReloadSignal = HUP
+//	Aliases = app-alias
+//
+//	[Environment]
+//	GOMAXPROCS = 2
+//
+// Keys holding a list, such as Arguments, Dependencies, Conflicts, Documentation
+// and the list options, are repeated for each element. Values may be double
+// quoted to keep surrounding spaces. Lines starting with '#' or ';' are
+// comments.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := NewConfig("")
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = line[1 : len(line)-1]
+			continue
+		}
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("%s:%d: Expected key = value", path, n)
+		}
+		key := strings.TrimSpace(line[:i])
+		value := strings.TrimSpace(line[i+1:])
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		switch section {
+		case "Service":
+			err = c.setField(key, value)
+		case "Option":
+			err = c.setOption(key, value)
+		case "Environment":
+			if c.EnvVars == nil {
+				c.EnvVars = make(map[string]string)
+			}
+			c.EnvVars[key] = value
+		default:
+			err = fmt.Errorf("Unknown section [%s]", section)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(c.Name) == 0 {
+		return nil, ErrNameFieldRequired
+	}
+	return c, nil
+}
+
+// setField sets the Config field named key.
+func (c *Config) setField(key, value string) error {
+	switch key {
+	case "Name":
+		c.Name = value
+	case "DisplayName":
+		c.DisplayName = value
+	case "Description":
+		c.Description = value
+	case "UserName":
+		c.UserName = value
+	case "Arguments":
+		c.Arguments = append(c.Arguments, value)
+	case "Executable":
+		c.Executable = value
+	case "Dependencies":
+		c.Dependencies = append(c.Dependencies, value)
+	case "Conflicts":
+		c.Conflicts = append(c.Conflicts, value)
+	case "Before":
+		c.Before = append(c.Before, value)
+	case "Documentation":
+		c.Documentation = append(c.Documentation, value)
+	case "WorkingDirectory":
+		c.WorkingDirectory = value
+	case "ChRoot":
+		c.ChRoot = value
+	case "Restart":
+		switch value {
+		case "never":
+			c.Restart = RestartNever
+		case "on-failure":
+			c.Restart = RestartOnFailure
+		case "always":
+			c.Restart = RestartAlways
+		default:
+			return fmt.Errorf("Unknown Restart %q, want never, on-failure or always", value)
+		}
+	default:
+		return fmt.Errorf("Unknown key %q in [Service]", key)
+	}
+	return nil
+}
+
+// setOption sets the option named key, converting value to its type.
+func (c *Config) setOption(key, value string) error {
+	kind, found := fileOptions[key]
+	if !found {
+		return fmt.Errorf("Unknown key %q in [Option]", key)
+	}
+	switch kind {
+	case optionKindBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		c.set(key, b)
+	case optionKindInt:
+		// RespawnCount also takes "unlimited" and TasksMax "infinity".
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			if key == optionRespawnCount && value == "unlimited" || key == optionTasksMax && value == "infinity" {
+				c.set(key, value)
+				break
+			}
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		c.set(key, i)
+	case optionKindStrings:
+		list, _ := c.Option[key].([]string)
+		c.set(key, append(list, value))
+	default:
+		c.set(key, value)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`# Example service.
+[Service]
+Name = app
+Description = "  My application.  "
+Arguments = -config
+Arguments = /etc/app.conf
+Restart = on-failure
+
+[Option]
+ReloadSignal = HUP
+KeepAlive = false
+RespawnCount = unlimited
+RecoveryRestartCount = 3
+Aliases = app-alias
+
+[Environment]
+GOMAXPROCS = 2
+`)
+	f.Close()
+
+	c, err := LoadConfig(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "app" || c.Description != "  My application.  " || c.Restart != RestartOnFailure {
+		t.Errorf("LoadConfig fields = %q, %q, %v", c.Name, c.Description, c.Restart)
+	}
+	if strings.Join(c.Arguments, " ") != "-config /etc/app.conf" {
+		t.Errorf("Arguments = %q", c.Arguments)
+	}
+	if c.Option.string(optionReloadSignal, "") != "HUP" ||
+		c.Option.bool(optionKeepAlive, true) ||
+		c.Option.string(optionRespawnCount, "") != "unlimited" ||
+		c.Option.int(optionRecoveryRestartCount, 0) != 3 ||
+		len(c.Option.stringSlice(optionAliases, nil)) != 1 {
+		t.Errorf("Option = %v", c.Option)
+	}
+	if c.EnvVars["GOMAXPROCS"] != "2" {
+		t.Errorf("EnvVars = %v", c.EnvVars)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for _, content := range []string{
+		"[Service]\nName = app\nBogus = 1\n",
+		"[Service]\nName = app\n[Option]\nBogus = 1\n",
+		"[Service]\nName = app\n[Option]\nKeepAlive = maybe\n",
+		"[Bogus]\nName = app\n",
+		"[Service]\nName\n",
+		"[Service]\nDescription = no name\n",
+	} {
+		f, err := ioutil.TempFile("", "servicetest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(content)
+		f.Close()
+		if _, err = LoadConfig(f.Name()); err == nil {
+			t.Errorf("LoadConfig(%q) want error, got nil", content)
+		}
+		os.Remove(f.Name())
+	}
+}
@@ -22,6 +22,11 @@ func init() {
 	ConsoleLogger.err = log.New(os.Stderr, "E: ", log.Ltime)
 }
 
+// Reopen does nothing, as os.Stderr is never reopened.
+func (c consoleLogger) Reopen() error {
+	return nil
+}
+
 func (c consoleLogger) Error(v ...interface{}) error {
 	c.err.Print(v...)
 	return nil
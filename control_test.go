@@ -0,0 +1,174 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// controlService records the control calls made on it.
+type controlService struct {
+	Service
+	called string
+	status Status
+	err    error
+}
+
+func (s *controlService) Start() error     { s.called = "start"; return s.err }
+func (s *controlService) Stop() error      { s.called = "stop"; return s.err }
+func (s *controlService) Restart() error   { s.called = "restart"; return s.err }
+func (s *controlService) Install() error   { s.called = "install"; return s.err }
+func (s *controlService) Uninstall() error { s.called = "uninstall"; return s.err }
+func (s *controlService) String() string   { return "test" }
+func (s *controlService) Status() (Status, error) {
+	return s.status, s.err
+}
+
+func TestControl(t *testing.T) {
+	for _, action := range ControlAction {
+		s := &controlService{}
+		if err := Control(s, action); err != nil {
+			t.Errorf("Control(%q) unexpected error: %v", action, err)
+		}
+		if s.called != action {
+			t.Errorf("Control(%q) called %q", action, s.called)
+		}
+	}
+	if err := Control(&controlService{}, "bogus"); err != ErrUnknownAction {
+		t.Errorf("Control(bogus) = %v, want ErrUnknownAction", err)
+	}
+	if err := Control(&controlService{err: errors.New("boom")}, "start"); err == nil {
+		t.Error("Control(start) want error, got nil")
+	}
+}
+
+func TestControlStatus(t *testing.T) {
+	tests := []struct {
+		status Status
+		err    error
+		want   string
+	}{
+		{StatusRunning, nil, "test: Running\n"},
+		{StatusStopped, nil, "test: Stopped\n"},
+		{StatusUnknown, ErrNotInstalled, "test: Not installed\n"},
+		{StatusDegraded, errors.New("probe failed"), "test: Degraded (probe failed)\n"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		if err := ControlStatus(&controlService{status: tt.status, err: tt.err}, &b); err != nil {
+			t.Errorf("ControlStatus(%v) unexpected error: %v", tt.status, err)
+		}
+		if b.String() != tt.want {
+			t.Errorf("ControlStatus(%v) = %q, want %q", tt.status, b.String(), tt.want)
+		}
+	}
+}
+
+// fakeSystem is a System that always detects.
+type fakeSystem struct{}
+
+func (fakeSystem) String() string    { return "fake" }
+func (fakeSystem) Detect() bool      { return true }
+func (fakeSystem) Interactive() bool { return true }
+func (fakeSystem) New(i Interface, c *Config) (Service, error) {
+	return &controlService{}, nil
+}
+
+func TestAddSystem(t *testing.T) {
+	saved := AvailableSystems()
+	defer ChooseSystem(saved...)
+
+	AddSystem(fakeSystem{})
+	if got := ChosenSystem(); got != (fakeSystem{}) {
+		t.Errorf("ChosenSystem = %v, want fake", got)
+	}
+	if n := len(AvailableSystems()); n != len(saved)+1 {
+		t.Errorf("AvailableSystems has %d systems, want %d", n, len(saved)+1)
+	}
+	s, err := New(nil, &Config{Name: "go_service_test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.(*controlService); !ok {
+		t.Errorf("New returned %T, want the fake system's service", s)
+	}
+}
+
+// stoppingService reports each status in turn after Stop.
+type stoppingService struct {
+	controlService
+	statuses []Status
+}
+
+func (s *stoppingService) Status() (Status, error) {
+	status := s.statuses[0]
+	if len(s.statuses) > 1 {
+		s.statuses = s.statuses[1:]
+	}
+	return status, nil
+}
+
+func TestStopAndWait(t *testing.T) {
+	defer func(d time.Duration) { stopPollInterval = d }(stopPollInterval)
+	stopPollInterval = time.Millisecond
+
+	s := &stoppingService{statuses: []Status{StatusRunning, StatusRunning, StatusStopped}}
+	if err := StopAndWait(context.Background(), s); err != nil {
+		t.Errorf("StopAndWait = %v, want nil", err)
+	}
+	if s.called != "stop" {
+		t.Errorf("StopAndWait called %q, want stop", s.called)
+	}
+
+	s = &stoppingService{statuses: []Status{StatusRunning, StatusFailed}}
+	if err := StopAndWait(context.Background(), s); err == nil || !strings.Contains(err.Error(), "failed") {
+		t.Errorf("StopAndWait = %v, want failed error", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	s = &stoppingService{statuses: []Status{StatusRunning}}
+	if err := StopAndWait(ctx, s); err == nil || !strings.Contains(err.Error(), "still stopping") {
+		t.Errorf("StopAndWait = %v, want still stopping error", err)
+	}
+}
+
+// slowSystem is a System whose detection blocks until its context is done.
+type slowSystem struct {
+	fakeSystem
+}
+
+func (slowSystem) detectContext(ctx context.Context) bool {
+	<-ctx.Done()
+	return true
+}
+
+func TestNewContext(t *testing.T) {
+	saved := AvailableSystems()
+	defer ChooseSystem(saved...)
+	ChooseSystem(fakeSystem{})
+
+	if _, err := NewContext(context.Background(), nil, &Config{Name: "go_service_test"}); err != nil {
+		t.Errorf("NewContext = %v, want nil", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewContext(ctx, nil, &Config{Name: "go_service_test"}); err != context.Canceled {
+		t.Errorf("NewContext with a cancelled context = %v, want context.Canceled", err)
+	}
+
+	// Set the registry directly, as ChooseSystem would block on detection.
+	systemRegistry = []System{slowSystem{}}
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := NewContext(ctx, nil, &Config{Name: "go_service_test"}); err != context.DeadlineExceeded {
+		t.Errorf("NewContext during detection = %v, want context.DeadlineExceeded", err)
+	}
+}
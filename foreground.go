@@ -0,0 +1,47 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// foregroundService is the Service runForeground hands to the Interface. Its
+// Logger returns the logger resolved for the run, so c is left untouched.
+type foregroundService struct {
+	Service
+	logger Logger
+}
+
+func (s foregroundService) Logger(errs chan<- error) (Logger, error) {
+	return s.logger, nil
+}
+
+// runForeground runs the Start and Stop lifecycle of i in the current process,
+// as if run interactively, until interrupted. While it runs, the Service passed
+// to i logs to ConsoleLogger unless c.Logger was set by the caller.
+func runForeground(i Interface, s Service, c *Config) error {
+	logger := c.Logger
+	if logger == nil {
+		logger = ConsoleLogger
+	}
+	fs := foregroundService{Service: s, logger: logger}
+
+	err := i.Start(fs)
+	if err != nil {
+		return err
+	}
+
+	stopReload := handleReload(i, fs, c)
+	var sigChan = make(chan os.Signal, 3)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	<-sigChan
+	signal.Stop(sigChan)
+	stopReload()
+
+	return i.Stop(fs)
+}
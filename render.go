@@ -0,0 +1,455 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// RenderSystemd returns the systemd unit Install would write for c, whatever
+// OS and init system the host runs. Nothing is installed or copied.
+func RenderSystemd(c *Config) (string, error) {
+	path, err := c.renderExecPath()
+	if err != nil {
+		return "", err
+	}
+	unit, err := (&systemd{Config: c}).unit(path, serviceType(c.Option))
+	return string(unit), err
+}
+
+// RenderUpstart returns the upstart job configuration Install would write for
+// c, whatever OS and init system the host runs. Nothing is installed or copied.
+func RenderUpstart(c *Config) (string, error) {
+	path, err := c.renderExecPath()
+	if err != nil {
+		return "", err
+	}
+	conf, err := (&upstart{Config: c}).conf(path)
+	return string(conf), err
+}
+
+// renderExecPath returns the executable an installed service runs, without
+// copying it for the CopyToPath option. An absolute Executable or CopyToPath
+// is a path on the target system and used as given, whatever the host.
+func (c *Config) renderExecPath() (string, error) {
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+	exec := c.Option.string(optionCopyToPath, c.Executable)
+	if len(exec) == 0 {
+		return c.execPath()
+	}
+	if path.IsAbs(exec) {
+		return exec, nil
+	}
+	return filepath.Abs(exec)
+}
+
+type systemd struct {
+	i Interface
+	*Config
+}
+
+// isUserService reports whether the service is installed into the user's
+// systemd manager instead of the system manager.
+func (s *systemd) isUserService() bool {
+	return s.Option.string(optionManagerScope, optionManagerScopeDefault) == "user" ||
+		s.Option.bool(optionUserService, optionUserServiceDefault)
+}
+
+func (s *systemd) template() *template.Template {
+	return template.Must(template.New("").Funcs(tf).Parse(systemdScript))
+}
+
+// unit renders the unit file that runs the executable at path as a service of
+// type typ.
+func (s *systemd) unit(path, typ string) ([]byte, error) {
+	hardening := hardeningProfiles[s.Option.string(optionHardeningProfile, "none")]
+	reloadSig, _ := reloadSignal(s.Option)
+	env, err := s.expandEnvVars(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var shellCommand string
+	if s.Option.bool(optionShellWrap, optionShellWrapDefault) {
+		words := []string{shellQuote(path)}
+		for _, arg := range s.Arguments {
+			words = append(words, shellQuote(arg))
+		}
+		if syntax := s.Option.string(optionShellSyntax, ""); len(syntax) != 0 {
+			words = append(words, syntax)
+		}
+		shellCommand = strings.Join(words, " ")
+	}
+	pidFile := s.Option.string(optionPIDFile, "")
+	var to = &struct {
+		*Config
+		Path          string
+		EnvVars       map[string]string
+		ReloadSignal  string
+		PIDFile       string
+		ReloadPIDFile bool
+		UserService   bool
+		Aliases       []string
+		Restart       string
+
+		GroupName       string
+		KillMode        string
+		OOMScoreAdjust  string
+		UMask           string
+		SuccessExit     string
+		TasksMax        string
+		Slice           string
+		Accounting      bool
+		WatchdogSec     string
+		ShellCommand    string
+		ProcessTitle    string
+		Type            string
+		BusName         string
+		RemainAfterExit bool
+
+		ConditionVirtualization string
+		ConditionHost           string
+		AssertPathExists        []string
+		RequiresMountsFor       []string
+
+		RawWorkingDirectory bool
+
+		AmbientCapabilities, CapabilityBoundingSet []string
+		SELinuxContext, AppArmorProfile            string
+
+		Hardening                       []string
+		UnitRaw, ServiceRaw, InstallRaw []string
+	}{
+		Config:        s.Config,
+		Path:          path,
+		EnvVars:       env,
+		ReloadSignal:  reloadSig,
+		PIDFile:       pidFile,
+		ReloadPIDFile: pidFile != "" && s.Option.bool(optionReloadPIDFile, optionReloadPIDFileDefault),
+		UserService:   s.isUserService(),
+		Aliases:       s.aliases(),
+		Restart:       s.restart(),
+
+		GroupName:       s.Option.string(optionGroupName, ""),
+		KillMode:        s.Option.string(optionKillMode, ""),
+		OOMScoreAdjust:  oomScoreAdjust(s.Option),
+		UMask:           umask(s.Option, 4),
+		SuccessExit:     s.Option.string(optionSuccessExitStatus, ""),
+		TasksMax:        tasksMax(s.Option),
+		Slice:           s.Option.string(optionSlice, ""),
+		Accounting:      s.Option.bool(optionEnableAccounting, optionEnableAccountingDefault),
+		WatchdogSec:     s.Option.string(optionWatchdogSec, ""),
+		ShellCommand:    shellCommand,
+		ProcessTitle:    s.Option.string(optionProcessTitle, ""),
+		Type:            typ,
+		BusName:         s.Option.string(optionBusName, ""),
+		RemainAfterExit: s.Option.bool(optionRemainAfterExit, optionRemainAfterExitDefault),
+
+		ConditionVirtualization: s.Option.string(optionConditionVirtualization, ""),
+		ConditionHost:           s.Option.string(optionConditionHost, ""),
+		AssertPathExists:        s.Option.stringSlice(optionAssertPathExists, nil),
+		RequiresMountsFor:       s.Option.stringSlice(optionRequiresMountsFor, nil),
+
+		RawWorkingDirectory: s.Option.bool(optionRawWorkingDirectory, optionRawWorkingDirectoryDefault),
+
+		AmbientCapabilities:   s.Option.stringSlice(optionAmbientCapabilities, nil),
+		CapabilityBoundingSet: s.Option.stringSlice(optionCapabilityBoundingSet, nil),
+		SELinuxContext:        s.Option.string(optionSELinuxContext, ""),
+		AppArmorProfile:       s.Option.string(optionAppArmorProfile, ""),
+
+		Hardening:  hardening,
+		UnitRaw:    s.Option.stringSlice(optionUnitRaw, nil),
+		ServiceRaw: s.Option.stringSlice(optionServiceRaw, nil),
+		InstallRaw: s.Option.stringSlice(optionInstallRaw, nil),
+	}
+
+	var b bytes.Buffer
+	if err = s.template().Execute(&b, to); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// restart returns the Restart= value for Config.Restart, or the Restart
+// option when it is unset.
+func (s *systemd) restart() string {
+	switch s.Config.Restart {
+	case RestartNever:
+		return "no"
+	case RestartOnFailure:
+		return "on-failure"
+	case RestartAlways:
+		return "always"
+	}
+	if serviceType(s.Option) == "oneshot" {
+		return s.Option.string(optionRestart, "no")
+	}
+	return s.Option.string(optionRestart, optionRestartDefault)
+}
+
+// aliases returns the unit names given in the Aliases option.
+func (s *systemd) aliases() []string {
+	aliases := s.Option.stringSlice(optionAliases, nil)
+	names := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		if !strings.HasSuffix(alias, ".service") {
+			alias += ".service"
+		}
+		names = append(names, alias)
+	}
+	return names
+}
+
+// tasksMax returns the TasksMax= value, or "" if the option is unset.
+func tasksMax(kv KeyValue) string {
+	if kv.string(optionTasksMax, "") == "infinity" {
+		return "infinity"
+	}
+	if _, found := kv[optionTasksMax]; !found {
+		return ""
+	}
+	return strconv.Itoa(kv.int(optionTasksMax, 0))
+}
+
+// hardeningProfiles holds the directives each HardeningProfile adds to the
+// [Service] section, as documented on Config.Option.
+var hardeningProfiles = map[string][]string{
+	"none": nil,
+	"basic": {
+		"NoNewPrivileges=yes",
+		"PrivateTmp=yes",
+		"ProtectSystem=full",
+		"ProtectHome=read-only",
+		"ProtectKernelTunables=yes",
+		"ProtectKernelModules=yes",
+		"ProtectControlGroups=yes",
+		"RestrictRealtime=yes",
+	},
+	"strict": {
+		"NoNewPrivileges=yes",
+		"PrivateTmp=yes",
+		"PrivateDevices=yes",
+		"ProtectSystem=strict",
+		"ProtectHome=yes",
+		"ProtectKernelTunables=yes",
+		"ProtectKernelModules=yes",
+		"ProtectControlGroups=yes",
+		"RestrictRealtime=yes",
+		"RestrictNamespaces=yes",
+		"RestrictSUIDSGID=yes",
+		"LockPersonality=yes",
+		"SystemCallArchitectures=native",
+		"SystemCallFilter=@system-service",
+	},
+}
+
+type upstart struct {
+	i Interface
+	*Config
+}
+
+func (s *upstart) template() *template.Template {
+	return template.Must(template.New("").Funcs(tf).Parse(upstartScript))
+}
+
+// conf renders the job configuration that runs the executable at path.
+func (s *upstart) conf(path string) ([]byte, error) {
+	env, err := s.expandEnvVars(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var to = &struct {
+		*Config
+		Path         string
+		EnvVars      map[string]string
+		Respawn      bool
+		RespawnLimit string
+		Expect       string
+		OOMScore     string
+		UMask        string
+		StartOn      string
+		StopOn       string
+		Emits        []string
+		OnFailure    bool
+	}{
+		Config:       s.Config,
+		Path:         path,
+		EnvVars:      env,
+		Respawn:      s.Config.Restart != RestartNever,
+		RespawnLimit: s.respawnLimit(),
+		Expect:       s.Option.string(optionExpect, ""),
+		OOMScore:     oomScoreAdjust(s.Option),
+		UMask:        umask(s.Option, 3),
+		StartOn:      s.Option.string(optionStartOn, optionStartOnDefault),
+		StopOn:       s.Option.string(optionStopOn, optionStopOnDefault),
+		Emits:        s.Option.stringSlice(optionEmits, nil),
+		OnFailure:    s.Config.Restart == RestartOnFailure,
+	}
+
+	var b bytes.Buffer
+	if err = s.template().Execute(&b, to); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// respawnLimit returns the arguments of the respawn limit stanza.
+func (s *upstart) respawnLimit() string {
+	if s.Option.string(optionRespawnCount, "") == "unlimited" {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d %d",
+		s.Option.int(optionRespawnCount, optionRespawnCountDefault),
+		s.Option.int(optionRespawnInterval, optionRespawnIntervalDefault))
+}
+
+// oomScoreAdjust returns the OOMScoreAdjust option, or "" if it is unset.
+func oomScoreAdjust(kv KeyValue) string {
+	if _, found := kv[optionOOMScoreAdjust]; !found {
+		return ""
+	}
+	return strconv.Itoa(kv.int(optionOOMScoreAdjust, 0))
+}
+
+// umask returns the UMask option as an octal number of digits digits.
+func umask(kv KeyValue, digits int) string {
+	mask, _ := strconv.ParseUint(kv.string(optionUMask, optionUMaskDefault), 8, 32)
+	return fmt.Sprintf("%0*o", digits, mask)
+}
+
+// shellQuote quotes s as a single POSIX shell word.
+func shellQuote(s string) string {
+	return `'` + strings.Replace(s, `'`, `'\''`, -1) + `'`
+}
+
+var tf = map[string]interface{}{
+	"cmd": func(s string) string {
+		return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+	},
+	"cmdEscape": func(s string) string {
+		return strings.Replace(s, " ", `\x20`, -1)
+	},
+	"shellQuote": shellQuote,
+	// systemdString quotes s as a single unit file argument, escaping the
+	// specifiers and variables systemd would otherwise expand.
+	"systemdString": func(s string) string {
+		s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`, `%`, `%%`).Replace(s)
+		return `"` + s + `"`
+	},
+	// systemdEnv quotes s as a single Environment= assignment. systemd expands
+	// specifiers there but not variables, so unlike systemdString it leaves $
+	// alone.
+	"systemdEnv": func(s string) string {
+		s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `%`, `%%`).Replace(s)
+		return `"` + s + `"`
+	},
+	// oneLine collapses whitespace, including line breaks that would end a
+	// unit file entry or script comment, into single spaces.
+	"oneLine": func(s string) string {
+		return strings.Join(strings.Fields(s), " ")
+	},
+}
+
+const systemdScript = `[Unit]
+Description={{.Description|oneLine}}
+{{if .Documentation}}Documentation={{range $i, $uri := .Documentation}}{{if $i}} {{end}}{{$uri}}{{end}}{{end}}
+{{if .Conflicts}}Conflicts={{range $i, $unit := .Conflicts}}{{if $i}} {{end}}{{$unit}}{{end}}{{end}}
+{{if .Before}}Before={{range $i, $unit := .Before}}{{if $i}} {{end}}{{$unit}}{{end}}{{end}}
+ConditionFileIsExecutable={{.Path|cmdEscape}}
+{{if .ConditionVirtualization}}ConditionVirtualization={{.ConditionVirtualization}}{{end}}
+{{if .ConditionHost}}ConditionHost={{.ConditionHost}}{{end}}
+{{range .AssertPathExists}}AssertPathExists={{.|cmdEscape}}
+{{end}}{{if .RequiresMountsFor}}RequiresMountsFor={{range $i, $path := .RequiresMountsFor}}{{if $i}} {{end}}{{$path|cmdEscape}}{{end}}
+{{end}}{{range .UnitRaw}}{{.}}
+{{end}}
+[Service]
+StartLimitInterval=5
+StartLimitBurst=10
+{{if .Type}}Type={{.Type}}{{end}}
+{{if .BusName}}BusName={{.BusName}}{{end}}
+{{if .RemainAfterExit}}RemainAfterExit=yes{{end}}
+{{if .ShellCommand}}ExecStart=/bin/sh -c {{.ShellCommand|systemdString}}
+{{else}}ExecStart={{if .ProcessTitle}}@{{.Path|cmdEscape}} {{.ProcessTitle|cmd}}{{else}}{{.Path|cmdEscape}}{{end}}{{range .Arguments}} {{.|cmd}}{{end}}
+{{end}}{{range .ExecStartExtra}}ExecStart={{range $i, $arg := .}}{{if $i}} {{$arg|cmd}}{{else}}{{$arg|cmdEscape}}{{end}}{{end}}
+{{end}}{{if .ExecStop}}ExecStop={{range $i, $arg := .ExecStop}}{{if $i}} {{$arg|cmd}}{{else}}{{$arg|cmdEscape}}{{end}}{{end}}{{end}}
+{{if .ChRoot}}RootDirectory={{.ChRoot|cmd}}{{end}}
+UMask={{.UMask}}
+{{if .WorkingDirectory}}WorkingDirectory={{if .RawWorkingDirectory}}{{.WorkingDirectory}}{{else}}{{.WorkingDirectory|cmdEscape}}{{end}}{{end}}
+{{if .UserName}}User={{.UserName}}{{end}}
+{{if .GroupName}}Group={{.GroupName}}{{end}}
+{{if .ProcessTitle}}SyslogIdentifier={{.ProcessTitle}}{{end}}
+{{if .AmbientCapabilities}}AmbientCapabilities={{range $i, $c := .AmbientCapabilities}}{{if $i}} {{end}}{{$c}}{{end}}{{end}}
+{{if .CapabilityBoundingSet}}CapabilityBoundingSet={{range $i, $c := .CapabilityBoundingSet}}{{if $i}} {{end}}{{$c}}{{end}}{{end}}
+{{if .SELinuxContext}}SELinuxContext={{.SELinuxContext}}{{end}}
+{{if .AppArmorProfile}}AppArmorProfile={{.AppArmorProfile}}{{end}}
+{{if .ReloadSignal}}ExecReload={{if .ReloadPIDFile}}/bin/sh -c {{printf "kill -%s $$(cat %s)" .ReloadSignal (shellQuote .PIDFile)|cmd}}{{else}}/bin/kill -{{.ReloadSignal}} "$MAINPID"{{end}}{{end}}
+{{if .PIDFile}}PIDFile={{.PIDFile|cmd}}{{end}}
+{{if .KillMode}}KillMode={{.KillMode}}{{end}}
+{{if .SuccessExit}}SuccessExitStatus={{.SuccessExit}}{{end}}
+{{if .TasksMax}}TasksMax={{.TasksMax}}{{end}}
+{{if .Slice}}Slice={{.Slice}}{{end}}
+{{if .Accounting}}MemoryAccounting=yes
+CPUAccounting=yes{{end}}
+{{if .OOMScoreAdjust}}OOMScoreAdjust={{.OOMScoreAdjust}}{{end}}
+Restart={{.Restart}}
+RestartSec=120
+{{if .WatchdogSec}}WatchdogSec={{.WatchdogSec}}{{end}}
+EnvironmentFile=-/etc/sysconfig/{{.Name}}
+{{range $k, $v := .EnvVars}}Environment={{printf "%s=%s" $k $v|systemdEnv}}
+{{end}}{{range .Hardening}}{{.}}
+{{end}}{{range .ServiceRaw}}{{.}}
+{{end}}
+[Install]
+WantedBy={{if .UserService}}default.target{{else}}multi-user.target{{end}}
+{{range .Aliases}}Alias={{.}}
+{{end}}{{range .InstallRaw}}{{.}}
+{{end}}`
+
+// The upstart script should stop with an INT or the Go runtime will terminate
+// the program before the Stop handler can run.
+const upstartScript = `# {{.Description|oneLine}}
+
+ {{if .DisplayName}}description    "{{.DisplayName|oneLine}}"{{end}}
+
+kill signal INT
+{{if .ChRoot}}chroot {{.ChRoot}}{{end}}
+{{if .WorkingDirectory}}chdir {{.WorkingDirectory}}{{end}}
+start on {{.StartOn}}
+stop on {{.StopOn}}
+{{if .Emits}}emits{{range .Emits}} {{.}}{{end}}{{end}}
+
+{{if .UserName}}setuid {{.UserName}}{{end}}
+{{if .Expect}}expect {{.Expect}}{{end}}
+{{if .OOMScore}}oom score {{.OOMScore}}{{end}}
+
+{{if .Respawn}}respawn
+respawn limit {{.RespawnLimit}}{{end}}
+{{if .OnFailure}}normal exit 0{{end}}
+umask {{.UMask}}
+{{range $k, $v := .EnvVars}}
+env {{$k}}={{$v|cmd}}{{end}}
+
+console none
+
+pre-start script
+    test -x {{.Path}} || { stop; exit 0; }
+end script
+{{if .ExecStop}}
+pre-stop script
+    {{range $i, $arg := .ExecStop}}{{if $i}} {{end}}{{$arg|shellQuote}}{{end}}
+end script
+{{end}}
+# Start
+exec {{.Path}}{{range .Arguments}} {{.|cmd}}{{end}}
+`
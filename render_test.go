@@ -0,0 +1,321 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	// The executable is a path on the target system, whatever the host.
+	c := &Config{Name: "go_service_test", Executable: "/usr/bin/app", Arguments: []string{"-v"}}
+	unit, err := RenderSystemd(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(unit, "\nExecStart=/usr/bin/app \"-v\"\n") {
+		t.Errorf("RenderSystemd lacks ExecStart:\n%s", unit)
+	}
+	conf, err := RenderUpstart(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(conf, "\nexec /usr/bin/app \"-v\"\n") {
+		t.Errorf("RenderUpstart lacks the exec stanza:\n%s", conf)
+	}
+	if _, err = RenderSystemd(&Config{}); err == nil {
+		t.Error("RenderSystemd of an invalid Config succeeded")
+	}
+}
+
+func TestRenderUMaskWorkingDirectory(t *testing.T) {
+	c := &Config{
+		Name:             "go_service_test",
+		Executable:       "/bin/true",
+		WorkingDirectory: "/srv/app",
+	}
+	for _, tt := range []struct {
+		option           KeyValue
+		systemd, upstart []string
+	}{
+		{KeyValue{}, []string{"\nUMask=0022\n", "\nWorkingDirectory=/srv/app\n"}, []string{"\numask 022\n", "\nchdir /srv/app\n"}},
+		{KeyValue{optionUMask: "0027"}, []string{"\nUMask=0027\n"}, []string{"\numask 027\n"}},
+	} {
+		c.Option = tt.option
+		unit, err := RenderSystemd(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf, err := RenderUpstart(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range tt.systemd {
+			if !strings.Contains(unit, line) {
+				t.Errorf("systemd unit for %v lacks %q:\n%s", tt.option, line, unit)
+			}
+		}
+		for _, line := range tt.upstart {
+			if !strings.Contains(conf, line) {
+				t.Errorf("upstart job for %v lacks %q:\n%s", tt.option, line, conf)
+			}
+		}
+	}
+}
+
+func TestUpstartRespawn(t *testing.T) {
+	tests := []struct {
+		restart             RestartPolicy
+		respawn, normalExit bool
+	}{
+		{RestartDefault, true, false},
+		{RestartAlways, true, false},
+		{RestartOnFailure, true, true},
+		{RestartNever, false, false},
+	}
+	for _, tt := range tests {
+		c := &Config{Name: "go_service_test", Executable: "/bin/true", Restart: tt.restart}
+		conf, err := RenderUpstart(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(conf, "\nrespawn\nrespawn limit 10 5\n"); got != tt.respawn {
+			t.Errorf("Restart %v: job respawns = %v, want %v:\n%s", tt.restart, got, tt.respawn, conf)
+		}
+		if got := strings.Contains(conf, "\nnormal exit 0\n"); got != tt.normalExit {
+			t.Errorf("Restart %v: job treats exit 0 as normal = %v, want %v:\n%s", tt.restart, got, tt.normalExit, conf)
+		}
+	}
+}
+
+func TestOneLine(t *testing.T) {
+	oneLine := tf["oneLine"].(func(string) string)
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"  padded\t", "padded"},
+		{"first line\nsecond line", "first line second line"},
+		{"crlf\r\n\r\n[Service]\r\nExecStart=/bin/sh", "crlf [Service] ExecStart=/bin/sh"},
+		{"Größe  und Maß", "Größe und Maß"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := oneLine(tt.in); got != tt.want {
+			t.Errorf("oneLine(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSystemdString(t *testing.T) {
+	systemdString := tf["systemdString"].(func(string) string)
+	tests := []struct {
+		in, want string
+	}{
+		{"'/usr/bin/app' *.conf | logger", `"'/usr/bin/app' *.conf | logger"`},
+		{`echo "$HOME" 100%`, `"echo \"$$HOME\" 100%%"`},
+		{`back\slash`, `"back\\slash"`},
+	}
+	for _, tt := range tests {
+		if got := systemdString(tt.in); got != tt.want {
+			t.Errorf("systemdString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRenderShellWrap(t *testing.T) {
+	c := &Config{
+		Name:       "go_service_test",
+		Executable: "/usr/bin/app",
+		Arguments:  []string{"a b", "it's;"},
+		Option:     KeyValue{optionShellWrap: true},
+	}
+	unit, err := RenderSystemd(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `ExecStart=/bin/sh -c "'/usr/bin/app' 'a b' 'it'\\''s;'"`
+	if !strings.Contains(unit, "\n"+want+"\n") {
+		t.Errorf("unit lacks %s:\n%s", want, unit)
+	}
+
+	c.Option[optionShellSyntax] = "*.conf | logger"
+	if unit, err = RenderSystemd(c); err != nil {
+		t.Fatal(err)
+	}
+	want = `ExecStart=/bin/sh -c "'/usr/bin/app' 'a b' 'it'\\''s;' *.conf | logger"`
+	if !strings.Contains(unit, "\n"+want+"\n") {
+		t.Errorf("unit lacks %s:\n%s", want, unit)
+	}
+}
+
+func TestRenderEnvironment(t *testing.T) {
+	c := &Config{
+		Name:       "go_service_test",
+		Executable: "/usr/bin/app",
+		EnvVars:    map[string]string{"APP_DIR": `%h\app "$HOME"`},
+	}
+	unit, err := RenderSystemd(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `Environment="APP_DIR=%%h\\app \"$HOME\""`
+	if !strings.Contains(unit, "\n"+want+"\n") {
+		t.Errorf("unit lacks %s:\n%s", want, unit)
+	}
+}
+
+// checkUnit reports each of lines that the unit RenderSystemd renders for c
+// lacks.
+func checkUnit(t *testing.T, c *Config, lines ...string) {
+	unit, err := RenderSystemd(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range lines {
+		if !strings.Contains(unit, line) {
+			t.Errorf("unit lacks %q:\n%s", line, unit)
+		}
+	}
+}
+
+func TestRenderExecStop(t *testing.T) {
+	checkUnit(t, &Config{
+		Name:        "go_service_test",
+		Description: "Test\nservice",
+		Executable:  "/bin/true",
+		Arguments:   []string{"-v"},
+		ExecStop:    []string{"/bin/echo", "drain now"},
+	}, "Description=Test service\n", "\nExecStart=/bin/true \"-v\"\n", "\nExecStop=/bin/echo \"drain now\"\n")
+}
+
+func TestRenderOrdering(t *testing.T) {
+	checkUnit(t, &Config{
+		Name:       "go_service_test",
+		Executable: "/bin/true",
+		Conflicts:  []string{"standby.service", "maintenance.target"},
+		Before:     []string{"nginx.service"},
+	}, "\nConflicts=standby.service maintenance.target\n", "\nBefore=nginx.service\n")
+}
+
+func TestRenderServiceRaw(t *testing.T) {
+	checkUnit(t, &Config{
+		Name:       "go_service_test",
+		Executable: "/bin/true",
+		Option:     KeyValue{optionServiceRaw: []string{"Nice=5"}},
+	}, "\nNice=5\n")
+}
+
+func TestRenderAssertPathExists(t *testing.T) {
+	checkUnit(t, &Config{
+		Name:       "go_service_test",
+		Executable: "/bin/true",
+		Option:     KeyValue{optionAssertPathExists: []string{"/etc/app.conf", "!/run/app.lock"}},
+	}, "\nAssertPathExists=/etc/app.conf\nAssertPathExists=!/run/app.lock\n")
+}
+
+func TestRenderRequiresMountsFor(t *testing.T) {
+	checkUnit(t, &Config{
+		Name:       "go_service_test",
+		Executable: "/bin/true",
+		Option:     KeyValue{optionRequiresMountsFor: []string{"/mnt/nfs data", "/srv"}},
+	}, "\nRequiresMountsFor=/mnt/nfs\\x20data /srv\n")
+}
+
+func TestRenderRawWorkingDirectory(t *testing.T) {
+	tests := []struct {
+		raw  bool
+		want string
+	}{
+		{false, "\nWorkingDirectory=/srv/%i\\x20data\n"},
+		{true, "\nWorkingDirectory=/srv/%i data\n"},
+	}
+	for _, tt := range tests {
+		checkUnit(t, &Config{
+			Name:             "go_service_test@",
+			Executable:       "/bin/true",
+			WorkingDirectory: "/srv/%i data",
+			Option:           KeyValue{optionRawWorkingDirectory: tt.raw},
+		}, tt.want)
+	}
+}
+
+func TestRenderProcessTitle(t *testing.T) {
+	checkUnit(t, &Config{
+		Name:       "go_service_test",
+		Executable: "/bin/true",
+		Arguments:  []string{"-v"},
+		Option:     KeyValue{optionProcessTitle: "app-worker"},
+	}, "\nExecStart=@/bin/true \"app-worker\" \"-v\"\n", "\nSyslogIdentifier=app-worker\n")
+}
+
+func TestRenderCapabilities(t *testing.T) {
+	checkUnit(t, &Config{
+		Name:       "go_service_test",
+		Executable: "/bin/true",
+		Option: KeyValue{
+			optionAmbientCapabilities:   []string{"CAP_NET_BIND_SERVICE"},
+			optionCapabilityBoundingSet: []string{"CAP_NET_BIND_SERVICE", "CAP_KILL"},
+		},
+	}, "\nAmbientCapabilities=CAP_NET_BIND_SERVICE\n", "\nCapabilityBoundingSet=CAP_NET_BIND_SERVICE CAP_KILL\n")
+}
+
+func TestRenderSecurityContext(t *testing.T) {
+	checkUnit(t, &Config{
+		Name:       "go_service_test",
+		Executable: "/bin/true",
+		Option: KeyValue{
+			optionSELinuxContext:  "system_u:system_r:app_t:s0",
+			optionAppArmorProfile: "-app",
+		},
+	}, "\nSELinuxContext=system_u:system_r:app_t:s0\n", "\nAppArmorProfile=-app\n")
+}
+
+func TestRenderTasksMax(t *testing.T) {
+	for _, tt := range []struct {
+		tasksMax interface{}
+		want     string
+	}{
+		{64, "\nTasksMax=64\n"},
+		{"infinity", "\nTasksMax=infinity\n"},
+	} {
+		checkUnit(t, &Config{
+			Name:       "go_service_test",
+			Executable: "/bin/true",
+			Option:     KeyValue{optionTasksMax: tt.tasksMax},
+		}, tt.want)
+	}
+	unit, err := RenderSystemd(&Config{Name: "go_service_test", Executable: "/bin/true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(unit, "TasksMax=") {
+		t.Errorf("unit without the TasksMax option sets it:\n%s", unit)
+	}
+}
+
+func TestRenderSuccessExitStatus(t *testing.T) {
+	checkUnit(t, &Config{
+		Name:       "go_service_test",
+		Executable: "/bin/true",
+		Option:     KeyValue{optionSuccessExitStatus: "3 SIGTERM"},
+	}, "\nSuccessExitStatus=3 SIGTERM\n")
+}
+
+func TestRenderSliceAccounting(t *testing.T) {
+	checkUnit(t, &Config{
+		Name:       "go_service_test",
+		Executable: "/bin/true",
+		Option:     KeyValue{optionSlice: "app.slice", optionEnableAccounting: true},
+	}, "\nSlice=app.slice\n", "\nMemoryAccounting=yes\nCPUAccounting=yes\n")
+	unit, err := RenderSystemd(&Config{Name: "go_service_test", Executable: "/bin/true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(unit, "Slice=") || strings.Contains(unit, "Accounting=") {
+		t.Errorf("unit without the Slice and EnableAccounting options sets them:\n%s", unit)
+	}
+}
@@ -3,7 +3,7 @@
 // license that can be found in the LICENSE file.
 
 // Package service provides a simple way to create a system service.
-// Currently supports Windows, Linux/(systemd | Upstart | SysV), and OSX/Launchd.
+// Currently supports Windows, Linux/(systemd | Upstart | runit | s6 | SysV), and OSX/Launchd.
 //
 // Windows controls services by setting up callbacks that is non-trivial. This
 // is very different then other systems. This package provides the same API
@@ -62,8 +62,15 @@
 package service // import "github.com/kardianos/service"
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
 )
 
 const (
@@ -75,10 +82,92 @@ const (
 	optionUserServiceDefault   = false
 	optionSessionCreate        = "SessionCreate"
 	optionSessionCreateDefault = false
+	optionManagerScope         = "ManagerScope"
+	optionManagerScopeDefault  = "system"
+	optionRestoreCon           = "RestoreCon"
+	optionRestoreConDefault    = false
+	optionOOMScoreAdjust       = "OOMScoreAdjust"
+	optionUMask                = "UMask"
+	optionUMaskDefault         = "022"
+	optionAliases              = "Aliases"
+	optionRestart              = "Restart"
+	optionRestartDefault       = "always"
+	optionWatchdogSec          = "WatchdogSec"
+	optionRestartWait          = "RestartWait"
+	optionAutoEnable           = "AutoEnable"
+	optionAutoEnableDefault    = true
+
+	optionUnitDir                 = "UnitDir"
+	optionSkipDaemonReload        = "SkipDaemonReload"
+	optionSkipDaemonReloadDefault = false
+	optionTargetRoot              = "TargetRoot"
+	optionKeepFile                = "KeepFile"
+	optionKeepFileDefault         = false
+
+	optionRespawnCount           = "RespawnCount"
+	optionRespawnCountDefault    = 10
+	optionRespawnInterval        = "RespawnInterval"
+	optionRespawnIntervalDefault = 5
+	optionExpect                 = "Expect"
+	optionStartOn                = "StartOn"
+	optionStartOnDefault         = "filesystem or runlevel [2345]"
+	optionStopOn                 = "StopOn"
+	optionStopOnDefault          = "runlevel [!2345]"
+	optionEmits                  = "Emits"
+
+	optionKillMode               = "KillMode"
+	optionSuccessExitStatus      = "SuccessExitStatus"
+	optionTasksMax               = "TasksMax"
+	optionHardeningProfile       = "HardeningProfile"
+	optionShellWrap              = "ShellWrap"
+	optionShellWrapDefault       = false
+	optionShellSyntax            = "ShellSyntax"
+	optionProcessTitle           = "ProcessTitle"
+	optionGroupName              = "GroupName"
+	optionServiceType            = "Type"
+	optionBusName                = "BusName"
+	optionRemainAfterExit        = "RemainAfterExit"
+	optionRemainAfterExitDefault = false
+
+	optionSlice                   = "Slice"
+	optionEnableAccounting        = "EnableAccounting"
+	optionEnableAccountingDefault = false
+
+	optionConditionVirtualization = "ConditionVirtualization"
+	optionConditionHost           = "ConditionHost"
+	optionAssertPathExists        = "AssertPathExists"
+	optionRequiresMountsFor       = "RequiresMountsFor"
+
+	optionAmbientCapabilities   = "AmbientCapabilities"
+	optionCapabilityBoundingSet = "CapabilityBoundingSet"
+	optionSELinuxContext        = "SELinuxContext"
+	optionAppArmorProfile       = "AppArmorProfile"
+
+	optionUnitRaw    = "UnitRaw"
+	optionServiceRaw = "ServiceRaw"
+	optionInstallRaw = "InstallRaw"
+
+	optionRawWorkingDirectory        = "RawWorkingDirectory"
+	optionRawWorkingDirectoryDefault = false
+
+	optionRecoveryRestartCount        = "RecoveryRestartCount"
+	optionRecoveryRestartDelay        = "RecoveryRestartDelay"
+	optionRecoveryRestartDelayDefault = "1m"
+	optionRecoveryResetPeriod         = "RecoveryResetPeriod"
+	optionRecoveryResetPeriodDefault  = 24 * 60 * 60
 
 	optionRunWait      = "RunWait"
 	optionReloadSignal = "ReloadSignal"
 	optionPIDFile      = "PIDFile"
+	optionForce        = "Force"
+	optionForceDefault = false
+	optionCopyToPath   = "CopyToPath"
+
+	optionSkipPathCheck        = "SkipPathCheck"
+	optionSkipPathCheckDefault = false
+
+	optionReloadPIDFile        = "ReloadPIDFile"
+	optionReloadPIDFileDefault = false
 )
 
 // Config provides the setup for a Service. The Name field is required.
@@ -86,31 +175,197 @@ type Config struct {
 	Name        string   // Required name of the service. No spaces suggested.
 	DisplayName string   // Display name, spaces allowed.
 	Description string   // Long description of service.
-	UserName    string   // Run as username.
+	UserName    string   // Run as username, or a numeric uid where the system accepts one.
 	Arguments   []string // Run with arguments.
 
 	// Optional field to specify the executable for service.
 	// If empty the current executable is used.
 	Executable string
 
+	// Environment variables to run the service with. Names are letters,
+	// digits and '_', not starting with a digit. Each value is a template
+	// executed against the Config when installing, so it may refer to the
+	// other fields, such as "{{.Name}}" or "{{.WorkingDirectory}}", to options
+	// as "{{index .Option \"PIDFile\"}}" and to the resolved executable as
+	// "{{.Path}}".
+	EnvVars map[string]string
+
+	// Optional probe run by Status when the service manager reports the
+	// service as running. A failing probe is reported as StatusDegraded.
+	HealthCheck func() error
+
+	// Optional logger returned by Service.Logger in place of the console or
+	// system logger.
+	Logger Logger
+
+	// When the service manager restarts the service after it exits.
+	// Leave unset to keep the default of each system.
+	Restart RestartPolicy
+
+	// Further commands, each with its arguments, run in order after the
+	// executable. Only supported by systemd for the oneshot service Type.
+	ExecStartExtra [][]string
+
+	// Optional command, with its arguments, run to stop the service before it
+	// is signalled, such as to drain connections. Supported by systemd and
+	// Upstart.
+	ExecStop []string
+
+	// Documentation URIs for the service, such as runbook links.
+	// Only used by systemd, which shows them in systemctl status.
+	Documentation []string
+
 	// Array of service dependencies.
-	// Not yet implemented on Linux or OS X.
+	// On Linux only used by SysV, as LSB facilities or init script names such
+	// as "$network". Not yet implemented on OS X.
 	Dependencies []string
 
+	// Units that cannot run alongside the service, such as the standby of a
+	// primary. Starting either stops the other. Only used by systemd.
+	Conflicts []string
+
+	// Units the service must start before, such as a target it prepares.
+	// Only used by systemd.
+	Before []string
+
+	// Sockets systemd listens on for the service, starting it on the first
+	// connection and passing the sockets on, as returned by Listeners. Only
+	// used by systemd.
+	Sockets []SocketConfig
+
 	// The following fields are not supported on Windows.
 	WorkingDirectory string // Initial working directory.
 	ChRoot           string
 
 	// System specific options.
 	//  * OS X
-	//    - KeepAlive     bool (true)
+	//    - KeepAlive     bool (true) - Used when Config.Restart is unset.
 	//    - RunAtLoad     bool (false)
 	//    - UserService   bool (false) - Install as a current user service.
 	//    - SessionCreate bool (false) - Create a full user session.
+	//  * Linux
+	//    - RestoreCon bool (false) - Run restorecon on the written file to apply its SELinux label.
+	//    - OOMScoreAdjust int () [-1000..1000] - Make the kernel OOM killer less (negative) or
+	//      more (positive) likely to pick the service. Unset inherits the default.
+	//    - UMask      string (022) [027, 0077, ...] - Octal file mode creation mask of the service,
+	//      the same under systemd and Upstart.
+	//  * Linux (Upstart)
+	//    - RespawnCount    int (10) - Respawns allowed within RespawnInterval before giving up.
+	//      The string "unlimited" never gives up.
+	//    - RespawnInterval int (5) - Seconds over which RespawnCount is counted.
+	//    - Expect          string () [fork, daemon, stop] - How the process signals it started,
+	//      for forking daemons. Unset for a process that stays in the foreground.
+	//    - StartOn         string (filesystem or runlevel [2345]) - Events that start the job,
+	//      written as they are, such as "net-device-up IFACE=eth0".
+	//    - StopOn          string (runlevel [!2345]) - Events that stop the job.
+	//    - Emits           []string () - Events the job emits, for tools that check event names.
+	//    - UnitDir         string () - Write the job to this directory instead of /etc/init,
+	//      where upstart does not see it, as when testing Install.
+	//  * Linux (systemd)
+	//    - UserService  bool (false) - Install into the user manager, same as ManagerScope user.
+	//    - Aliases      []string () - Additional names for the unit, removed again on Uninstall.
+	//    - Restart      string (always) [no, on-success, on-failure, on-abnormal, on-watchdog,
+	//      on-abort, always] - Native Restart= value, used when Config.Restart is unset.
+	//      on-watchdog requires WatchdogSec.
+	//    - WatchdogSec  string () [30s, 1min, ...] - Time within which the service must send
+	//      WATCHDOG=1 through sd_notify before systemd considers it hung.
+	//    - RestartWait  string () [5s, 1m, ...] - Time the unit must stay up after Restart, as parsed
+	//      by time.ParseDuration. Restart then returns an error if the unit failed or is
+	//      restarting after a crash. Unset returns once systemctl restart does.
+	//    - AutoEnable   bool (true) - Enable the unit on Install. When false the unit is only
+	//      loaded, to be enabled later.
+	//    - UnitDir      string () - Write the unit to this directory instead of the one systemd
+	//      reads, without enabling or reloading it, as when testing Install.
+	//    - SkipDaemonReload bool (false) - Do not run daemon-reload on Install. The unit is not
+	//      known to systemd until DaemonReload is called, as when installing many units at once.
+	//    - TargetRoot   string () - Install the unit into the system below this directory, as when
+	//      building an OS image, enabling it there through systemctl --root and not reloading the
+	//      running systemd. CopyToPath is copied below it too. Not supported for user services.
+	//    - KeepFile     bool (false) - Uninstall stops and disables the unit but leaves its unit
+	//      files in place, as when a package manager removes them.
+	//    - GroupName       string () - Group to run as, a name or a numeric gid. A numeric
+	//      UserName or GroupName is passed through without looking it up.
+	//    - Type            string (simple) [simple, exec, forking, oneshot, dbus, notify,
+	//      notify-reload, idle] - Service type. forking requires PIDFile and dbus a BusName
+	//      option or BusName= line in ServiceRaw. Only oneshot may have ExecStartExtra, and is not restarted
+	//      unless Config.Restart asks for it. notify and notify-reload expect the program to
+	//      send READY=1 to $NOTIFY_SOCKET once started. exec falls back to simple, with a
+	//      warning, when the host systemd is older than 240.
+	//    - BusName         string () - Well-known D-Bus name, such as "org.example.App", the
+	//      service takes once ready. Makes Type default to dbus.
+	//    - KillMode        string () [control-group, process, mixed, none] - Processes stopped
+	//      with the service. process and none leave child processes running after Stop.
+	//    - SuccessExitStatus string () - Space separated exit codes and signal names, such
+	//      as "3 SIGUSR1", that count as a clean exit rather than a failure.
+	//    - TasksMax        int () - Most tasks, processes and threads, the service may have at
+	//      once. The string "infinity" sets no limit.
+	//    - Slice           string () [app.slice] - Slice unit to run the service under.
+	//    - EnableAccounting bool (false) - Turn on memory and CPU accounting for the service,
+	//      which ResourceUsage needs to report anything but zero.
+	//    - HardeningProfile string (none) [none, basic, strict] - Sandboxing directives to add.
+	//      basic: NoNewPrivileges=yes, PrivateTmp=yes, ProtectSystem=full, ProtectHome=read-only,
+	//      ProtectKernelTunables=yes, ProtectKernelModules=yes, ProtectControlGroups=yes,
+	//      RestrictRealtime=yes.
+	//      strict: NoNewPrivileges=yes, PrivateTmp=yes, PrivateDevices=yes, ProtectSystem=strict,
+	//      ProtectHome=yes, ProtectKernelTunables=yes, ProtectKernelModules=yes,
+	//      ProtectControlGroups=yes, RestrictRealtime=yes, RestrictNamespaces=yes,
+	//      RestrictSUIDSGID=yes, LockPersonality=yes, SystemCallArchitectures=native,
+	//      SystemCallFilter=@system-service. With strict the file system is read-only
+	//      apart from /dev, /proc and /sys, so add ReadWritePaths= through ServiceRaw.
+	//    - ShellWrap       bool (false) - Run the executable through /bin/sh -c, with it and
+	//      each argument quoted as a single shell word. systemd then no longer executes the
+	//      program directly, so the main process it tracks and signals is the shell.
+	//    - ShellSyntax     string () [*.conf | logger] - Shell syntax for globs, pipes and the
+	//      like, added unquoted after the arguments. Needs ShellWrap.
+	//    - ProcessTitle    string () - Name the process by, as SyslogIdentifier= for the journal
+	//      and, unless ShellWrap is set, as its argv[0] through ExecStart=@, so ps shows it.
+	//      Only argv[0] changes: a Go program cannot rewrite the rest of its command line,
+	//      and /proc/PID/comm and os.Executable still name the executable.
+	//    - AmbientCapabilities   []string () [CAP_NET_BIND_SERVICE, ...] - Capabilities kept by
+	//      a service running as a non-root UserName.
+	//    - CapabilityBoundingSet []string () [CAP_NET_BIND_SERVICE, ...] - The only capabilities
+	//      the service may ever hold. A "~" before the first name drops the listed ones instead.
+	//    - SELinuxContext  string () - SELinux security context to run the service in.
+	//    - AppArmorProfile string () - AppArmor profile to confine the service with.
+	//    - RemainAfterExit bool (false) - Consider the service running after its process
+	//      exited successfully, as for a oneshot service that applies settings.
+	//    - ConditionVirtualization string () [no, vm, container, kvm, ...] - Only start in this environment.
+	//    - ConditionHost           string () - Only start on the host with this name or machine ID.
+	//    - AssertPathExists        []string () - Absolute paths that must exist, or with a "!"
+	//      prefix must not. Unlike a Condition, a failed assertion fails the unit start.
+	//    - RequiresMountsFor       []string () - Absolute paths whose mounts, network and
+	//      automounts included, must be up before the service starts.
+	//    - UnitRaw    []string () - Lines appended to the [Unit] section as they are.
+	//    - ServiceRaw []string () - Lines appended to the [Service] section as they are.
+	//    - InstallRaw []string () - Lines appended to the [Install] section as they are.
+	//      The raw lines are not validated; a malformed line breaks the unit.
+	//    - RawWorkingDirectory bool (false) - Write Config.WorkingDirectory as it is, so specifiers
+	//      such as %i in /srv/%i expand per instance and spaces are not escaped.
+	//    - ManagerScope string (system) [system, user] - Manager instance to install into.
+	//      The user manager is reached through $DBUS_SESSION_BUS_ADDRESS, or when unset the
+	//      bus socket in $XDG_RUNTIME_DIR (default /run/user/<uid>), as in rootless containers.
+	//  * Windows
+	//    - RecoveryRestartCount int (0) - Times to restart the service after it fails before giving up.
+	//      With Config.Restart set to OnFailure or Always and no count the restarts never stop.
+	//    - RecoveryRestartDelay string (1m) - Delay before each restart, as parsed by time.ParseDuration.
+	//    - RecoveryResetPeriod  int (86400) - Seconds without failure after which the count is reset.
 	//  * POSIX
 	//    - RunWait      func() (wait for SIGNAL) - Do not install signal but wait for this function to return.
-	//    - ReloadSignal string () [USR1, ...] - Signal to send on reaload.
+	//    - ReloadSignal string () [USR1, SIGHUP, ...] - Signal to send on reaload.
+	//      Run calls Reload on an Interface that implements Reloader when it is received,
+	//      after reopening Config.Logger if it implements Reopener.
 	//    - PIDFile     string () [/run/prog.pid] - Location of the PID file.
+	//      systemd tracks the main process through it, as a Type=forking service
+	//      requires, and SysV scripts read it, waiting up to 10 seconds for the
+	//      program to write it, instead of recording the process they start.
+	//    - ReloadPIDFile bool (false) - Send ReloadSignal to the process in PIDFile
+	//      instead of the main process systemd tracks. Needs PIDFile.
+	//    - SkipPathCheck bool (false) - Do not check on Install that the executable exists
+	//      inside ChRoot.
+	//    - Force        bool (false) - Overwrite the configuration of an installed service on Install.
+	//    - CopyToPath   string () [/usr/local/bin/prog] - Copy the executable here on Install, keeping
+	//      its mode, and run the copy, so the service does not depend on where it was installed from.
+	//      Nothing is copied when Install fails because the service is already installed.
 	Option KeyValue
 }
 
@@ -119,13 +374,49 @@ var (
 	systemRegistry []System
 )
 
+// CommandOutput, if set, receives the standard output and error of the
+// commands run to install and control a service, such as systemctl enable
+// and daemon-reload, as they run. When nil the output is discarded.
+var CommandOutput io.Writer
+
 var (
 	// ErrNameFieldRequired is returned when Conifg.Name is empty.
 	ErrNameFieldRequired = errors.New("Config.Name field is required.")
 	// ErrNoServiceSystemDetected is returned when no system was detected.
 	ErrNoServiceSystemDetected = errors.New("No service system detected.")
+	// ErrNoInitSystem is the same error as ErrNoServiceSystemDetected.
+	ErrNoInitSystem = ErrNoServiceSystemDetected
+	// ErrNotInstalled is returned when the service is not installed.
+	ErrNotInstalled = errors.New("The service is not installed.")
+	// ErrAlreadyInstalled is returned by Install when the service is already installed.
+	ErrAlreadyInstalled = errors.New("The service is already installed.")
+	// ErrUnknownAction is returned by Control for an action it does not know.
+	ErrUnknownAction = errors.New("Unknown action.")
+	// ErrUserServiceUnsupported is wrapped by the error returned when the
+	// UserService option is set for a service system without user services.
+	// On Go 1.13 and later test for it with errors.Is. On older Go, where
+	// errors.Is is missing, check the error's Unwrap method:
+	//
+	//	u, ok := err.(interface{ Unwrap() error })
+	//	unsupported := ok && u.Unwrap() == service.ErrUserServiceUnsupported
+	ErrUserServiceUnsupported = errors.New("User services are not supported.")
+	// ErrNotSupported is returned by functions, such as Listeners and
+	// StatusAll, that the system does not support.
+	ErrNotSupported = errors.New("Not supported on this system.")
 )
 
+// userServiceError names the service system without user services and
+// unwraps to ErrUserServiceUnsupported.
+type userServiceError string
+
+func (e userServiceError) Error() string {
+	return "User services are not supported on " + string(e) + "."
+}
+
+func (e userServiceError) Unwrap() error {
+	return ErrUserServiceUnsupported
+}
+
 // New creates a new service based on a service interface and configuration.
 func New(i Interface, c *Config) (Service, error) {
 	if len(c.Name) == 0 {
@@ -137,6 +428,69 @@ func New(i Interface, c *Config) (Service, error) {
 	return system.New(i, c)
 }
 
+// NewContext is like New but detects the service system again, from the
+// systems last passed to ChooseSystem, and runs the commands detection needs
+// under ctx. It returns the error of ctx if ctx is done before a system is
+// detected.
+func NewContext(ctx context.Context, i Interface, c *Config) (Service, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(c.Name) == 0 {
+		return nil, ErrNameFieldRequired
+	}
+	s := newSystemContext(ctx)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, ErrNoServiceSystemDetected
+	}
+	return s.New(i, c)
+}
+
+// checkHealth runs the HealthCheck, if any, for a service reported as running.
+func (c *Config) checkHealth(status Status, err error) (Status, error) {
+	if err != nil || status != StatusRunning || c.HealthCheck == nil {
+		return status, err
+	}
+	if err = c.HealthCheck(); err != nil {
+		return StatusDegraded, err
+	}
+	return status, nil
+}
+
+// expandEnvVars returns EnvVars with each value executed as a template against
+// the Config and the executable path.
+func (c *Config) expandEnvVars(path string) (map[string]string, error) {
+	if len(c.EnvVars) == 0 {
+		return nil, nil
+	}
+	data := &struct {
+		*Config
+		Path string
+	}{c, path}
+	env := make(map[string]string, len(c.EnvVars))
+	for name, value := range c.EnvVars {
+		if !validEnvName(name) {
+			return nil, fmt.Errorf("Invalid environment variable name %q", name)
+		}
+		t, err := template.New(name).Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("Environment variable %s: %v", name, err)
+		}
+		var b bytes.Buffer
+		if err = t.Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("Environment variable %s: %v", name, err)
+		}
+		if strings.ContainsAny(b.String(), "\r\n") {
+			return nil, fmt.Errorf("Environment variable %s contains a line break", name)
+		}
+		env[name] = b.String()
+	}
+	return env, nil
+}
+
 // KeyValue provides a list of platform specific options. See platform docs for
 // more details.
 type KeyValue map[string]interface{}
@@ -174,6 +528,17 @@ func (kv KeyValue) string(name string, defaultValue string) string {
 	return defaultValue
 }
 
+// stringSlice returns the value of the given name, assuming the value is a []string.
+// If the value isn't found or is not of the type, the defaultValue is returned.
+func (kv KeyValue) stringSlice(name string, defaultValue []string) []string {
+	if v, found := kv[name]; found {
+		if castValue, is := v.([]string); is {
+			return castValue
+		}
+	}
+	return defaultValue
+}
+
 // float64 returns the value of the given name, assuming the value is a float64.
 // If the value isn't found or is not of the type, the defaultValue is returned.
 func (kv KeyValue) float64(name string, defaultValue float64) float64 {
@@ -204,6 +569,18 @@ func Platform() string {
 	return system.String()
 }
 
+// DetectSystem returns the name of the detected system service, as Platform
+// does, or ErrNoInitSystem if none was detected. On Linux the init systems are
+// considered in the order systemd, Upstart, runit, s6 and SysV; under WSL only
+// systemd running as PID 1 is, so callers can check InWSL to explain that
+// systemd=true must be set in the [boot] section of /etc/wsl.conf.
+func DetectSystem() (string, error) {
+	if system == nil {
+		return "", ErrNoServiceSystemDetected
+	}
+	return system.String(), nil
+}
+
 // Interactive returns false if running under the OS service manager
 // and true otherwise.
 func Interactive() bool {
@@ -213,12 +590,30 @@ func Interactive() bool {
 	return system.Interactive()
 }
 
+// contextDetector is implemented by systems whose detection runs commands
+// that can be stopped when a context is done.
+type contextDetector interface {
+	detectContext(ctx context.Context) bool
+}
+
 func newSystem() System {
+	return newSystemContext(context.Background())
+}
+
+func newSystemContext(ctx context.Context) System {
 	for _, choice := range systemRegistry {
-		if choice.Detect() == false {
-			continue
+		if ctx.Err() != nil {
+			return nil
+		}
+		detected := false
+		if d, ok := choice.(contextDetector); ok {
+			detected = d.detectContext(ctx)
+		} else {
+			detected = choice.Detect()
+		}
+		if detected {
+			return choice
 		}
-		return choice
 	}
 	return nil
 }
@@ -231,6 +626,15 @@ func ChooseSystem(a ...System) {
 	system = newSystem()
 }
 
+// AddSystem registers a system service, such as a backend for a custom
+// supervisor, ahead of the built in ones and chooses the system again.
+// Systems are considered in order and the first whose Detect returns true is
+// used, so a system added later takes precedence over one added earlier and
+// over the built in systems when both detect.
+func AddSystem(s System) {
+	ChooseSystem(append([]System{s}, systemRegistry...)...)
+}
+
 // ChosenSystem returns the system that service will use.
 func ChosenSystem() System {
 	return system
@@ -283,6 +687,72 @@ type Interface interface {
 	Stop(s Service) error
 }
 
+// Reloader is implemented by an Interface that can reload its configuration
+// without stopping. On POSIX Run calls Reload each time the process receives
+// the ReloadSignal option, under a service manager or in the foreground.
+type Reloader interface {
+	Reload(s Service) error
+}
+
+// SocketConfig is a socket systemd listens on for a socket activated service.
+// Each is installed as a socket unit, NAME.socket for the first and
+// NAME-N.socket for the Nth after it.
+type SocketConfig struct {
+	// Address to listen on, such as ":8080", "127.0.0.1:9090" or
+	// "/run/app.sock", as for ListenStream=.
+	ListenStream string
+
+	// Name the service gets the socket back by from Listeners, such as
+	// "http" or "metrics". When empty the socket goes by its unit name.
+	FileDescriptorName string
+}
+
+// RestartPolicy tells the service manager when to restart a service that exits.
+type RestartPolicy byte
+
+const (
+	// RestartDefault keeps the restart behavior of the service system.
+	RestartDefault RestartPolicy = iota
+	// RestartNever leaves the service stopped once it exits.
+	RestartNever
+	// RestartOnFailure restarts the service when it exits with an error.
+	RestartOnFailure
+	// RestartAlways restarts the service whenever it exits.
+	RestartAlways
+)
+
+// Status represents the state of a service.
+type Status byte
+
+const (
+	// StatusUnknown means the status could not be determined due to an error
+	// or because the service is not installed.
+	StatusUnknown Status = iota
+	// StatusRunning means the service is running.
+	StatusRunning
+	// StatusStopped means the service is stopped.
+	StatusStopped
+	// StatusFailed means the service manager gave up on the service.
+	StatusFailed
+	// StatusDegraded means the service is running but Config.HealthCheck failed.
+	StatusDegraded
+)
+
+var statusNames = [...]string{
+	StatusUnknown:  "Unknown",
+	StatusRunning:  "Running",
+	StatusStopped:  "Stopped",
+	StatusFailed:   "Failed",
+	StatusDegraded: "Degraded",
+}
+
+func (s Status) String() string {
+	if int(s) >= len(statusNames) {
+		return statusNames[StatusUnknown]
+	}
+	return statusNames[s]
+}
+
 // TODO: Add Configure to Service interface.
 
 // Service represents a service that can be run or controlled.
@@ -292,6 +762,13 @@ type Service interface {
 	// After Run stops blocking, the program must exit shortly after.
 	Run() error
 
+	// RunForeground runs the service in the current process without the
+	// service manager, as when debugging: Interface.Start is called, then
+	// Interface.Stop once the process is interrupted, and Logger returns
+	// ConsoleLogger meanwhile unless Config.Logger is set. The service does
+	// not need to be installed.
+	RunForeground() error
+
 	// Start signals to the OS service manager the given service should start.
 	Start() error
 
@@ -301,6 +778,11 @@ type Service interface {
 	// Restart signals to the OS service manager the given service should stop then start.
 	Restart() error
 
+	// Status returns the state of the service as reported by the OS service
+	// manager. If Config.HealthCheck is set it is run for a running service
+	// and its error returned along with StatusDegraded if it fails.
+	Status() (Status, error)
+
 	// Install setups up the given service in the OS service manager. This may require
 	// greater rights. Will return an error if it is already installed.
 	Install() error
@@ -309,10 +791,15 @@ type Service interface {
 	// greater rights. Will return an error if the service is not present.
 	Uninstall() error
 
+	// ConfigPath returns where Install writes the service configuration,
+	// such as the systemd unit file or launchd plist. It follows the user
+	// service options. On Windows it is the registry key of the service.
+	ConfigPath() (string, error)
+
 	// Opens and returns a system logger. If the user program is running
 	// interactively rather then as a service, the returned logger will write to
 	// os.Stderr. If errs is non-nil errors will be sent on errs as well as
-	// returned from Logger's functions.
+	// returned from Logger's functions. Config.Logger, if set, is returned instead.
 	Logger(errs chan<- error) (Logger, error)
 
 	// SystemLogger opens and returns a system logger. If errs is non-nil errors
@@ -325,9 +812,12 @@ type Service interface {
 }
 
 // ControlAction list valid string texts to use in Control.
+// Control also accepts "status".
 var ControlAction = [5]string{"start", "stop", "restart", "install", "uninstall"}
 
 // Control issues control functions to the service from a given action string.
+// The "status" action prints the status to os.Stdout, as ControlStatus does.
+// An action not listed returns ErrUnknownAction.
 func Control(s Service, action string) error {
 	var err error
 	switch action {
@@ -341,8 +831,10 @@ func Control(s Service, action string) error {
 		err = s.Install()
 	case ControlAction[4]:
 		err = s.Uninstall()
+	case "status":
+		err = ControlStatus(s, os.Stdout)
 	default:
-		err = fmt.Errorf("Unknown action %s", action)
+		return ErrUnknownAction
 	}
 	if err != nil {
 		return fmt.Errorf("Failed to %s %v: %v", action, s, err)
@@ -350,6 +842,82 @@ func Control(s Service, action string) error {
 	return nil
 }
 
+// ControlStatus writes the status of the service to w as a line such as
+// "my-service: Running".
+func ControlStatus(s Service, w io.Writer) error {
+	status, err := s.Status()
+	if err == ErrNotInstalled {
+		_, err = fmt.Fprintf(w, "%v: Not installed\n", s)
+		return err
+	}
+	if err != nil && status != StatusDegraded {
+		return err
+	}
+	if err != nil {
+		_, err = fmt.Fprintf(w, "%v: %v (%v)\n", s, status, err)
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%v: %v\n", s, status)
+	return err
+}
+
+// RestartReport restarts the service and reports whether it was running
+// beforehand, telling a restart apart from a start of a stopped service.
+func RestartReport(s Service) (restarted bool, err error) {
+	status, _ := s.Status()
+	restarted = status == StatusRunning || status == StatusDegraded
+	if err = s.Restart(); err != nil {
+		return false, err
+	}
+	return restarted, nil
+}
+
+// stopPollInterval is how often StopAndWait queries the service status.
+var stopPollInterval = 250 * time.Millisecond
+
+// StopAndWait stops the service and waits until its status is StatusStopped.
+// It returns an error as soon as the service is reported failed, or once ctx
+// is done while it is still stopping.
+func StopAndWait(ctx context.Context, s Service) error {
+	if err := s.Stop(); err != nil {
+		return err
+	}
+	for {
+		status, err := s.Status()
+		switch {
+		case err != nil:
+			return err
+		case status == StatusStopped:
+			return nil
+		case status == StatusFailed:
+			return fmt.Errorf("%v failed while stopping", s)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v still stopping, %v: %v", s, status, ctx.Err())
+		case <-time.After(stopPollInterval):
+		}
+	}
+}
+
+// DaemonReexec makes the service manager of s re-execute itself. It does
+// nothing for service systems other than systemd.
+func DaemonReexec(s Service) error {
+	if r, ok := s.(interface {
+		DaemonReexec() error
+	}); ok {
+		return r.DaemonReexec()
+	}
+	return nil
+}
+
+// Reopener is implemented by loggers that hold a connection or file to reopen
+// after log rotation. On POSIX Run calls Reopen on Config.Logger, if it is a
+// Reopener, each time the process receives the ReloadSignal option.
+type Reopener interface {
+	Reopen() error
+}
+
 // Logger writes to the system log.
 type Logger interface {
 	Error(v ...interface{}) error
@@ -5,12 +5,14 @@
 package service
 
 import (
+	"bytes"
 	"errors"
-	"fmt"
+	"net"
 	"os"
 	"os/signal"
 	"os/user"
 	"path/filepath"
+	"regexp"
 	"syscall"
 	"text/template"
 	"time"
@@ -56,6 +58,30 @@ func init() {
 	}
 }
 
+// InContainer reports whether the process runs inside a container. It is
+// always false on this system.
+func InContainer() bool {
+	return false
+}
+
+// InWSL reports whether the process runs under the Windows Subsystem for
+// Linux. It is always false on this system.
+func InWSL() bool {
+	return false
+}
+
+// Listeners returns ErrNotSupported, as only systemd passes sockets to the
+// process.
+func Listeners() (map[string]net.Listener, error) {
+	return nil, ErrNotSupported
+}
+
+// StatusAll returns ErrNotSupported, as only systemd reports the status of
+// many services in one call.
+func StatusAll(names []string) (map[string]Status, error) {
+	return nil, ErrNotSupported
+}
+
 func isInteractive() (bool, error) {
 	// TODO: The PPID of Launchd is 1. The PPid of a service process should match launchd's PID.
 	return os.Getppid() != 1, nil
@@ -100,16 +126,18 @@ func (s *darwinLaunchdService) getServiceFilePath() (string, error) {
 	return "/Library/LaunchDaemons/" + s.Name + ".plist", nil
 }
 
+func (s *darwinLaunchdService) ConfigPath() (string, error) {
+	return s.getServiceFilePath()
+}
+
 func (s *darwinLaunchdService) Install() error {
 	confPath, err := s.getServiceFilePath()
 	if err != nil {
 		return err
 	}
-	_, err = os.Stat(confPath)
-	if err == nil {
-		return fmt.Errorf("Init already exists: %s", confPath)
+	if err = s.Validate(); err != nil {
+		return err
 	}
-
 	if s.userService {
 		// Ensure that ~/Library/LaunchAgents exists.
 		err = os.MkdirAll(filepath.Dir(confPath), 0700)
@@ -118,29 +146,54 @@ func (s *darwinLaunchdService) Install() error {
 		}
 	}
 
-	f, err := os.Create(confPath)
+	path, err := s.installExecPath(confPath)
+	if err != nil {
+		return err
+	}
+	plist, err := s.plist(path)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	path, err := s.execPath()
+	f, err := createConfig(confPath, 0644, s.Option.bool(optionForce, optionForceDefault))
 	if err != nil {
 		return err
 	}
+	defer f.Close()
+
+	_, err = f.Write(plist)
+	return err
+}
+
+// plist renders the launchd property list that runs the executable at path.
+func (s *darwinLaunchdService) plist(path string) ([]byte, error) {
+	env, err := s.expandEnvVars(path)
+	if err != nil {
+		return nil, err
+	}
 
 	var to = &struct {
 		*Config
-		Path string
+		Path    string
+		EnvVars map[string]string
 
 		KeepAlive, RunAtLoad bool
 		SessionCreate        bool
+		OnFailure            bool
 	}{
 		Config:        s.Config,
 		Path:          path,
+		EnvVars:       env,
 		KeepAlive:     s.Option.bool(optionKeepAlive, optionKeepAliveDefault),
 		RunAtLoad:     s.Option.bool(optionRunAtLoad, optionRunAtLoadDefault),
 		SessionCreate: s.Option.bool(optionSessionCreate, optionSessionCreateDefault),
+		OnFailure:     s.Config.Restart == RestartOnFailure,
+	}
+	switch s.Config.Restart {
+	case RestartNever:
+		to.KeepAlive = false
+	case RestartAlways:
+		to.KeepAlive = true
 	}
 
 	functions := template.FuncMap{
@@ -152,7 +205,11 @@ func (s *darwinLaunchdService) Install() error {
 		},
 	}
 	t := template.Must(template.New("launchdConfig").Funcs(functions).Parse(launchdConfig))
-	return t.Execute(f, to)
+	var b bytes.Buffer
+	if err = t.Execute(&b, to); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
 }
 
 func (s *darwinLaunchdService) Uninstall() error {
@@ -165,6 +222,10 @@ func (s *darwinLaunchdService) Uninstall() error {
 	return os.Remove(confPath)
 }
 
+func (s *darwinLaunchdService) RunForeground() error {
+	return runForeground(s.i, s, s.Config)
+}
+
 func (s *darwinLaunchdService) Start() error {
 	confPath, err := s.getServiceFilePath()
 	if err != nil {
@@ -188,6 +249,28 @@ func (s *darwinLaunchdService) Restart() error {
 	return s.Start()
 }
 
+func (s *darwinLaunchdService) Status() (Status, error) {
+	return s.checkHealth(s.status())
+}
+
+var launchdPID = regexp.MustCompile(`"PID" = ([0-9]+);`)
+
+func (s *darwinLaunchdService) status() (Status, error) {
+	confPath, err := s.getServiceFilePath()
+	if err != nil {
+		return StatusUnknown, err
+	}
+	if _, err = os.Stat(confPath); err != nil {
+		return StatusUnknown, ErrNotInstalled
+	}
+	// Fails for services that are not loaded.
+	out, _ := runWithOutput("launchctl", "list", s.Name)
+	if launchdPID.MatchString(out) {
+		return StatusRunning, nil
+	}
+	return StatusStopped, nil
+}
+
 func (s *darwinLaunchdService) Run() error {
 	var err error
 
@@ -196,16 +279,21 @@ func (s *darwinLaunchdService) Run() error {
 		return err
 	}
 
+	stopReload := handleReload(s.i, s, s.Config)
 	s.Option.funcSingle(optionRunWait, func() {
 		var sigChan = make(chan os.Signal, 3)
 		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
 		<-sigChan
 	})()
+	stopReload()
 
 	return s.i.Stop(s)
 }
 
 func (s *darwinLaunchdService) Logger(errs chan<- error) (Logger, error) {
+	if s.Config.Logger != nil {
+		return s.Config.Logger, nil
+	}
 	if interactive {
 		return ConsoleLogger, nil
 	}
@@ -230,9 +318,13 @@ var launchdConfig = `<?xml version='1.0' encoding='UTF-8'?>
 </array>
 {{if .UserName}}<key>UserName</key><string>{{html .UserName}}</string>{{end}}
 {{if .ChRoot}}<key>RootDirectory</key><string>{{html .ChRoot}}</string>{{end}}
+{{if .EnvVars}}<key>EnvironmentVariables</key>
+<dict>
+{{range $k, $v := .EnvVars}}        <key>{{html $k}}</key><string>{{html $v}}</string>
+{{end}}</dict>{{end}}
 {{if .WorkingDirectory}}<key>WorkingDirectory</key><string>{{html .WorkingDirectory}}</string>{{end}}
 <key>SessionCreate</key><{{bool .SessionCreate}}/>
-<key>KeepAlive</key><{{bool .KeepAlive}}/>
+<key>KeepAlive</key>{{if .OnFailure}}<dict><key>SuccessfulExit</key><false/></dict>{{else}}<{{bool .KeepAlive}}/>{{end}}
 <key>RunAtLoad</key><{{bool .RunAtLoad}}/>
 <key>Disabled</key><false/>
 </dict>
@@ -0,0 +1,47 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLaunchdKeepAlive(t *testing.T) {
+	tests := []struct {
+		restart   RestartPolicy
+		keepAlive bool
+		want      string
+	}{
+		{RestartDefault, false, "<key>KeepAlive</key><false/>"},
+		{RestartDefault, true, "<key>KeepAlive</key><true/>"},
+		{RestartAlways, false, "<key>KeepAlive</key><true/>"},
+		{RestartOnFailure, false, "<key>KeepAlive</key><dict><key>SuccessfulExit</key><false/></dict>"},
+		{RestartNever, true, "<key>KeepAlive</key><false/>"},
+	}
+	for _, tt := range tests {
+		s := &darwinLaunchdService{Config: &Config{
+			Name:    "go_service_test",
+			Restart: tt.restart,
+			Option:  KeyValue{optionKeepAlive: tt.keepAlive},
+		}}
+		b, err := s.plist("/usr/local/bin/app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), tt.want) {
+			t.Errorf("Restart %v, KeepAlive %v: plist lacks %s:\n%s", tt.restart, tt.keepAlive, tt.want, b)
+		}
+	}
+}
+
+func TestSystemdOnlyFunctions(t *testing.T) {
+	if _, err := Listeners(); err != ErrNotSupported {
+		t.Errorf("Listeners = %v, want ErrNotSupported", err)
+	}
+	if _, err := StatusAll([]string{"go_service_test"}); err != ErrNotSupported {
+		t.Errorf("StatusAll = %v, want ErrNotSupported", err)
+	}
+}
@@ -5,13 +5,18 @@
 package service
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
 type linuxSystemService struct {
 	name        string
-	detect      func() bool
+	detect      func(ctx context.Context) bool
 	interactive func() bool
 	new         func(i Interface, c *Config) (Service, error)
 }
@@ -20,7 +25,10 @@ func (sc linuxSystemService) String() string {
 	return sc.name
 }
 func (sc linuxSystemService) Detect() bool {
-	return sc.detect()
+	return sc.detect(context.Background())
+}
+func (sc linuxSystemService) detectContext(ctx context.Context) bool {
+	return sc.detect(ctx)
 }
 func (sc linuxSystemService) Interactive() bool {
 	return sc.interactive()
@@ -29,6 +37,13 @@ func (sc linuxSystemService) New(i Interface, c *Config) (Service, error) {
 	return sc.new(i, c)
 }
 
+// The init systems are detected in the order systemd, Upstart, runit, s6 and
+// SysV. Each requires the binaries used to control it to be present.
+//
+// Under WSL PID 1 is the init of WSL itself unless systemd is enabled by
+// setting systemd=true in the [boot] section of /etc/wsl.conf, and nothing
+// else starts services on boot, so only systemd running as PID 1 is detected
+// there. Otherwise New fails with ErrNoServiceSystemDetected.
 func init() {
 	ChooseSystem(linuxSystemService{
 		name:   "linux-systemd",
@@ -48,9 +63,27 @@ func init() {
 			},
 			new: newUpstartService,
 		},
+		linuxSystemService{
+			name:   "linux-runit",
+			detect: isRunit,
+			interactive: func() bool {
+				is, _ := isInteractive()
+				return is
+			},
+			new: newRunitService,
+		},
+		linuxSystemService{
+			name:   "linux-s6",
+			detect: isS6,
+			interactive: func() bool {
+				is, _ := isInteractive()
+				return is
+			},
+			new: newS6Service,
+		},
 		linuxSystemService{
 			name:   "unix-systemv",
-			detect: func() bool { return true },
+			detect: isSystemV,
 			interactive: func() bool {
 				is, _ := isInteractive()
 				return is
@@ -58,18 +91,145 @@ func init() {
 			new: newSystemVService,
 		},
 	)
+	if InWSL() {
+		ChooseSystem(pid1System(systemRegistry[0].(linuxSystemService), "systemd"))
+	}
+}
+
+// warnf logs a warning to the logger of s about a step that did not stop
+// Install or Uninstall.
+func warnf(s Service, format string, a ...interface{}) {
+	if l, err := s.Logger(nil); err == nil {
+		l.Warningf(format, a...)
+	}
 }
 
+// readProcFile reads the named file below /proc. It is replaced in tests.
+var readProcFile = func(name string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join("/proc", name))
+}
+
+// pid1System returns sc that is only detected when PID 1 runs the program
+// named comm.
+func pid1System(sc linuxSystemService, comm string) linuxSystemService {
+	detect := sc.detect
+	sc.detect = func(ctx context.Context) bool {
+		pid1, err := readProcFile("1/comm")
+		return err == nil && strings.TrimSpace(string(pid1)) == comm && detect(ctx)
+	}
+	return sc
+}
+
+// InWSL reports whether the process runs under the Windows Subsystem for
+// Linux, as detected from the kernel version.
+func InWSL() bool {
+	version, err := readProcFile("version")
+	return err == nil && strings.Contains(strings.ToLower(string(version)), "microsoft")
+}
+
+// containerMarkers lists the files Docker and Podman create in the root of a
+// container. It is replaced in tests.
+var containerMarkers = []string{"/.dockerenv", "/run/.containerenv"}
+
+// InContainer reports whether the process runs inside a container, as
+// detected from the marker files of Docker and Podman, the container
+// variable set by systemd-nspawn and LXC, and the control groups of PID 1.
+func InContainer() bool {
+	for _, marker := range containerMarkers {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+	if env, err := readProcFile("1/environ"); err == nil {
+		for _, kv := range strings.Split(string(env), "\x00") {
+			if strings.HasPrefix(kv, "container=") {
+				return true
+			}
+		}
+	}
+	cgroup, err := readProcFile("1/cgroup")
+	if err != nil {
+		return false
+	}
+	for _, hint := range [...]string{"docker", "kubepods", "containerd", "libpod", "lxc"} {
+		if strings.Contains(string(cgroup), hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// initNames lists the names PID 1 has when it is the init of a service system.
+// Upstart runs as init.
+var initNames = [...]string{"systemd", "init", "runit", "runsvdir", "s6-svscan"}
+
 func isInteractive() (bool, error) {
 	// TODO: This is not true for user services.
-	return os.Getppid() != 1, nil
+	return os.Getppid() != 1 || containerWithoutInit(), nil
 }
 
-var tf = map[string]interface{}{
-	"cmd": func(s string) string {
-		return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
-	},
-	"cmdEscape": func(s string) string {
-		return strings.Replace(s, " ", `\x20`, -1)
-	},
+// containerWithoutInit reports whether the process runs inside a container
+// whose PID 1 is not the init of a service system. Such a PID 1 is often a
+// minimal init, such as tini or dumb-init, that only reaps processes, so the
+// program is not run as a service and logs to the console rather than to a
+// syslog the container likely lacks.
+func containerWithoutInit() bool {
+	if !InContainer() {
+		return false
+	}
+	pid1, err := readProcFile("1/comm")
+	if err != nil {
+		return false
+	}
+	for _, name := range initNames {
+		if strings.TrimSpace(string(pid1)) == name {
+			return false
+		}
+	}
+	return true
+}
+
+// restoreCon resets the SELinux context of path if the RestoreCon option is
+// set and restorecon is available.
+func restoreCon(kv KeyValue, path string) error {
+	if !kv.bool(optionRestoreCon, optionRestoreConDefault) {
+		return nil
+	}
+	if _, err := exec.LookPath("restorecon"); err != nil {
+		return nil
+	}
+	return run("restorecon", path)
+}
+
+// writeFinish writes the finish script run by a runit or s6 supervisor after
+// the service exits. The supervisors restart a service unconditionally, so the
+// script runs down, a command that takes the service directory, to honor
+// RestartNever and RestartOnFailure.
+func writeFinish(kv KeyValue, dir, down string, policy RestartPolicy) error {
+	path := filepath.Join(dir, "finish")
+	if policy != RestartNever && policy != RestartOnFailure {
+		// Drop the script of a forced reinstall with another policy.
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	// The run script, created first, already guards against a second install.
+	f, err := createConfig(path, 0755, true)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// Both supervisors pass the exit code as the first argument.
+	test := ""
+	if policy == RestartOnFailure {
+		test = `[ "$1" = 0 ] && `
+	}
+	if _, err = fmt.Fprintf(f, "#!/bin/sh\n%sexec %s \"$(pwd)\"\nexit 0\n", test, down); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return restoreCon(kv, path)
 }
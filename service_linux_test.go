@@ -0,0 +1,458 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCheckArguments(t *testing.T) {
+	tests := []struct {
+		arg   string
+		valid bool
+	}{
+		{"plain", true},
+		{"embedded space", true},
+		{`"double" 'single'`, true},
+		{"100%", true},
+		{"%i", true},
+		{"tab\tseparated", true},
+		{"new\nline", false},
+		{"carriage\rreturn", false},
+		{"nul\x00byte", false},
+		{"escape\x1b", false},
+	}
+	for _, tt := range tests {
+		err := checkArguments([]string{"-flag", tt.arg})
+		if tt.valid && err != nil {
+			t.Errorf("checkArguments(%q) unexpected error: %v", tt.arg, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("checkArguments(%q) want error, got nil", tt.arg)
+		}
+	}
+}
+
+func TestCreateConfigMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A permissive umask must not leak into the created file.
+	defer syscall.Umask(syscall.Umask(0))
+
+	for _, perm := range []os.FileMode{0644, 0755} {
+		path := filepath.Join(dir, perm.String())
+		f, err := createConfig(path, perm, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fi.Mode().Perm(); got != perm {
+			t.Errorf("createConfig(%v) mode = %v", perm, got)
+		}
+	}
+}
+
+func TestCreateConfigExists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "unit")
+	if err = ioutil.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = createConfig(path, 0644, false); err != ErrAlreadyInstalled {
+		t.Errorf("createConfig on existing file = %v, want ErrAlreadyInstalled", err)
+	}
+	f, err := createConfig(path, 0644, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if fi, err := os.Stat(path); err != nil || fi.Size() != 0 {
+		t.Errorf("forced createConfig did not truncate: %v", err)
+	}
+}
+
+// Status polls spawn a command each time, as upstart does with initctl;
+// repeated polls must not leak file descriptors.
+func TestRunCommandWithOutputFDs(t *testing.T) {
+	if _, err := exec.LookPath("true"); err != nil {
+		t.Skip("true not found")
+	}
+	openFDs := func() int {
+		fds, err := ioutil.ReadDir("/proc/self/fd")
+		if err != nil {
+			t.Skip("cannot list open files:", err)
+		}
+		return len(fds)
+	}
+
+	before := openFDs()
+	for i := 0; i < 100; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		runCommandWithOutput(exec.CommandContext(ctx, "true"))
+		cancel()
+	}
+	if after := openFDs(); after > before+2 {
+		t.Errorf("open files grew from %d to %d", before, after)
+	}
+}
+
+func TestCommandOutput(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	var out bytes.Buffer
+	CommandOutput = &out
+	defer func() { CommandOutput = nil }()
+
+	if err := run("sh", "-c", "echo enabled; echo reloaded >&2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, "enabled\n") || !strings.Contains(got, "reloaded\n") {
+		t.Errorf("CommandOutput got %q, want stdout and stderr", got)
+	}
+}
+
+func TestReloadSignal(t *testing.T) {
+	tests := []struct {
+		sig   string
+		want  string
+		valid bool
+	}{
+		{"", "", true},
+		{"HUP", "HUP", true},
+		{"SIGHUP", "HUP", true},
+		{"usr1", "USR1", true},
+		{"SIGUSR9", "", false},
+		{"HUP; rm -rf /", "", false},
+	}
+	for _, tt := range tests {
+		got, err := reloadSignal(KeyValue{optionReloadSignal: tt.sig})
+		if tt.valid && (err != nil || got != tt.want) {
+			t.Errorf("reloadSignal(%q) = %q, %v, want %q", tt.sig, got, err, tt.want)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("reloadSignal(%q) want error, got %q", tt.sig, got)
+		}
+	}
+}
+
+// reloadProgram counts the Reload calls made on it.
+type reloadProgram struct {
+	reloaded chan struct{}
+}
+
+func (p *reloadProgram) Start(s Service) error { return nil }
+func (p *reloadProgram) Stop(s Service) error  { return nil }
+func (p *reloadProgram) Reload(s Service) error {
+	p.reloaded <- struct{}{}
+	return nil
+}
+
+// reopenLogger records the Reopen calls made on it.
+type reopenLogger struct {
+	consoleLogger
+	reopened int
+}
+
+func (l *reopenLogger) Reopen() error {
+	l.reopened++
+	return nil
+}
+
+func TestHandleReload(t *testing.T) {
+	p := &reloadProgram{reloaded: make(chan struct{}, 1)}
+	l := &reopenLogger{consoleLogger: ConsoleLogger}
+	c := &Config{Name: "go_service_test", Logger: l, Option: KeyValue{optionReloadSignal: "USR1"}}
+	stop := handleReload(p, &controlService{}, c)
+	defer stop()
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-p.reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reload not called on SIGUSR1")
+	}
+	if l.reopened != 1 {
+		t.Errorf("Logger reopened %d times, want 1", l.reopened)
+	}
+}
+
+// foregroundProgram records the logger of the Service it is started with and
+// interrupts its process until stopped.
+type foregroundProgram struct {
+	logger  Logger
+	stopped chan struct{}
+}
+
+func (p *foregroundProgram) Start(s Service) error {
+	p.logger, _ = s.Logger(nil)
+	go func() {
+		for {
+			syscall.Kill(os.Getpid(), syscall.SIGINT)
+			select {
+			case <-p.stopped:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+	return nil
+}
+
+func (p *foregroundProgram) Stop(s Service) error {
+	close(p.stopped)
+	return nil
+}
+
+func TestRunForeground(t *testing.T) {
+	// Keep an interrupt arriving before runForeground listens from ending the test.
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt)
+	defer signal.Stop(sigChan)
+
+	p := &foregroundProgram{stopped: make(chan struct{})}
+	c := &Config{Name: "go_service_test"}
+	if err := runForeground(p, &sysv{i: p, Config: c}, c); err != nil {
+		t.Fatal(err)
+	}
+	if p.logger != ConsoleLogger {
+		t.Errorf("Start got logger %v, want ConsoleLogger", p.logger)
+	}
+	if c.Logger != nil {
+		t.Errorf("runForeground set Config.Logger to %v", c.Logger)
+	}
+}
+
+func TestCheckChRoot(t *testing.T) {
+	root, err := ioutil.TempDir("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err = os.MkdirAll(filepath.Join(root, "usr", "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(root, "usr", "bin", "app"), nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		c     *Config
+		valid bool
+	}{
+		{&Config{}, true},
+		{&Config{ChRoot: root}, true},
+		{&Config{ChRoot: root, UserName: "nobody"}, true},
+		{&Config{ChRoot: "/nonexistent-chroot"}, false},
+		{&Config{ChRoot: "/nonexistent-chroot", Option: KeyValue{optionSkipPathCheck: true}}, true},
+	}
+	for i, tt := range tests {
+		err := checkChRoot(tt.c, "/usr/bin/app")
+		if tt.valid && err != nil {
+			t.Errorf("%d: checkChRoot unexpected error: %v", i, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%d: checkChRoot want error, got nil", i)
+		}
+	}
+}
+
+func TestRenderMatchesInstall(t *testing.T) {
+	dir, err := ioutil.TempDir("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &Config{
+		Name:       "go_service_test",
+		Executable: "/bin/true",
+		Option:     KeyValue{optionUnitDir: dir},
+	}
+	unit, err := RenderSystemd(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = (&systemd{Config: c}).Install(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "go_service_test.service"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unit != string(b) {
+		t.Errorf("RenderSystemd differs from the installed unit:\n%s", unit)
+	}
+}
+
+// fakeProc replaces readProcFile with one that serves files from a map, and
+// returns a function that restores it.
+func fakeProc(files map[string]string) func() {
+	saved := readProcFile
+	readProcFile = func(name string) ([]byte, error) {
+		data, ok := files[name]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(data), nil
+	}
+	return func() { readProcFile = saved }
+}
+
+func TestWSLDetection(t *testing.T) {
+	defer fakeProc(map[string]string{"version": "Linux version 5.15.90.1-microsoft-standard-WSL2"})()
+	if !InWSL() {
+		t.Error("InWSL = false for a WSL kernel, want true")
+	}
+	defer fakeProc(map[string]string{"version": "Linux version 6.1.0-13-amd64"})()
+	if InWSL() {
+		t.Error("InWSL = true for a Debian kernel, want false")
+	}
+
+	always := linuxSystemService{
+		name:        "linux-systemd",
+		detect:      func(context.Context) bool { return true },
+		interactive: func() bool { return false },
+		new:         newSystemdService,
+	}
+	for _, comm := range []string{"init", "systemd"} {
+		defer fakeProc(map[string]string{"1/comm": comm + "\n"})()
+		if got, want := pid1System(always, "systemd").Detect(), comm == "systemd"; got != want {
+			t.Errorf("detected with PID 1 %s = %v, want %v", comm, got, want)
+		}
+	}
+
+	saved := AvailableSystems()
+	defer ChooseSystem(saved...)
+	defer fakeProc(map[string]string{"1/comm": "init\n"})()
+	ChooseSystem(pid1System(always, "systemd"))
+	if _, err := New(nil, &Config{Name: "go_service_test"}); err != ErrNoServiceSystemDetected {
+		t.Errorf("New with PID 1 init = %v, want ErrNoServiceSystemDetected", err)
+	}
+}
+
+func TestWriteFinish(t *testing.T) {
+	tests := []struct {
+		down    string
+		restart RestartPolicy
+		want    string
+	}{
+		{"sv down", RestartDefault, ""},
+		{"sv down", RestartAlways, ""},
+		{"sv down", RestartOnFailure, "#!/bin/sh\n[ \"$1\" = 0 ] && exec sv down \"$(pwd)\"\nexit 0\n"},
+		{"sv down", RestartNever, "#!/bin/sh\nexec sv down \"$(pwd)\"\nexit 0\n"},
+		{"s6-svc -O", RestartDefault, ""},
+		{"s6-svc -O", RestartAlways, ""},
+		{"s6-svc -O", RestartOnFailure, "#!/bin/sh\n[ \"$1\" = 0 ] && exec s6-svc -O \"$(pwd)\"\nexit 0\n"},
+		{"s6-svc -O", RestartNever, "#!/bin/sh\nexec s6-svc -O \"$(pwd)\"\nexit 0\n"},
+	}
+	for _, tt := range tests {
+		dir, err := ioutil.TempDir("", "servicetest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		// A finish script left by an earlier install is replaced or removed.
+		if err = ioutil.WriteFile(filepath.Join(dir, "finish"), []byte("old"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = writeFinish(nil, dir, tt.down, tt.restart); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(filepath.Join(dir, "finish"))
+		if tt.want == "" {
+			if !os.IsNotExist(err) {
+				t.Errorf("%s, Restart %v: finish script %q exists, want none", tt.down, tt.restart, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s, Restart %v: finish script %q, want %q", tt.down, tt.restart, got, tt.want)
+		}
+	}
+}
+
+func TestInContainer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dockerenv := filepath.Join(dir, ".dockerenv")
+	saved := containerMarkers
+	defer func() { containerMarkers = saved }()
+	containerMarkers = []string{dockerenv}
+
+	tests := []struct {
+		marker bool
+		proc   map[string]string
+		want   bool
+	}{
+		{false, map[string]string{"1/cgroup": "0::/init.scope\n"}, false},
+		{true, map[string]string{"1/cgroup": "0::/init.scope\n"}, true},
+		{false, map[string]string{"1/environ": "PATH=/bin\x00container=podman\x00"}, true},
+		{false, map[string]string{"1/cgroup": "12:memory:/docker/3f2a9c\n"}, true},
+		{false, map[string]string{"1/cgroup": "0::/kubepods/besteffort/pod1\n"}, true},
+		{false, nil, false},
+	}
+	for _, tt := range tests {
+		os.Remove(dockerenv)
+		if tt.marker {
+			if err = ioutil.WriteFile(dockerenv, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		restore := fakeProc(tt.proc)
+		if got := InContainer(); got != tt.want {
+			t.Errorf("InContainer with /.dockerenv %v and %q = %v, want %v", tt.marker, tt.proc, got, tt.want)
+		}
+		restore()
+	}
+
+	if err = ioutil.WriteFile(dockerenv, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, comm := range []string{"tini", "systemd", "init", "s6-svscan"} {
+		restore := fakeProc(map[string]string{"1/comm": comm + "\n"})
+		if got, want := containerWithoutInit(), comm == "tini"; got != want {
+			t.Errorf("containerWithoutInit with PID 1 %s = %v, want %v", comm, got, want)
+		}
+		restore()
+	}
+	os.Remove(dockerenv)
+	defer fakeProc(map[string]string{"1/comm": "tini\n"})()
+	if containerWithoutInit() {
+		t.Error("containerWithoutInit outside a container = true, want false")
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/template"
+)
+
+func isRunit(context.Context) bool {
+	if _, err := exec.LookPath("sv"); err != nil {
+		return false
+	}
+	if _, err := os.Stat("/etc/runit"); err == nil {
+		return true
+	}
+	if _, err := exec.LookPath("runsv"); err == nil {
+		return true
+	}
+	return false
+}
+
+type runit struct {
+	i Interface
+	*Config
+}
+
+func newRunitService(i Interface, c *Config) (Service, error) {
+	s := &runit{
+		i:      i,
+		Config: c,
+	}
+
+	return s, nil
+}
+
+func (s *runit) String() string {
+	if len(s.DisplayName) > 0 {
+		return s.DisplayName
+	}
+	return s.Name
+}
+
+var errNoUserServiceRunit error = userServiceError("runit")
+
+// serviceDir returns the directory holding the run script.
+func (s *runit) serviceDir() (string, error) {
+	if s.Option.bool(optionUserService, optionUserServiceDefault) {
+		return "", errNoUserServiceRunit
+	}
+	return "/etc/sv/" + s.Config.Name, nil
+}
+
+// configPath returns the path of the run script.
+func (s *runit) configPath() (cp string, err error) {
+	dir, err := s.serviceDir()
+	if err != nil {
+		return
+	}
+	cp = filepath.Join(dir, "run")
+	return
+}
+
+// runitServiceDirs lists the directories runsvdir supervises. Void Linux uses
+// /var/service, Debian and others /etc/service.
+var runitServiceDirs = [...]string{"/var/service", "/etc/service"}
+
+// linkPath returns the path the service directory is linked to in order to
+// enable it.
+func (s *runit) linkPath() (string, error) {
+	for _, dir := range runitServiceDirs {
+		if _, err := os.Stat(dir); err == nil {
+			return filepath.Join(dir, s.Config.Name), nil
+		}
+	}
+	return "", errors.New("No runit service directory found.")
+}
+
+func (s *runit) template() *template.Template {
+	return template.Must(template.New("").Funcs(tf).Parse(runitScript))
+}
+
+// script renders the run script that runs the executable at path.
+func (s *runit) script(path string) ([]byte, error) {
+	env, err := s.expandEnvVars(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var to = &struct {
+		*Config
+		Path    string
+		EnvVars map[string]string
+	}{
+		Config:  s.Config,
+		Path:    path,
+		EnvVars: env,
+	}
+
+	var b bytes.Buffer
+	if err = s.template().Execute(&b, to); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// ConfigPath returns the service directory that holds the run script.
+func (s *runit) ConfigPath() (string, error) {
+	return s.configPath()
+}
+
+// Install creates the service directory and links it into the supervised
+// directory. runsvdir starts the service shortly after it is linked.
+func (s *runit) Install() error {
+	confPath, err := s.configPath()
+	if err != nil {
+		return err
+	}
+	if err = s.Validate(); err != nil {
+		return err
+	}
+	link, err := s.linkPath()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(confPath), 0755); err != nil {
+		return err
+	}
+	path, err := s.installExecPath(confPath)
+	if err != nil {
+		return err
+	}
+
+	script, err := s.script(path)
+	if err != nil {
+		return err
+	}
+	f, err := createConfig(confPath, 0755, s.Option.bool(optionForce, optionForceDefault))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err = f.Write(script); err != nil {
+		return err
+	}
+	// The script must not be open for writing once the supervisor runs it.
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = restoreCon(s.Option, confPath); err != nil {
+		return err
+	}
+	if err = writeFinish(s.Option, filepath.Dir(confPath), "sv down", s.Config.Restart); err != nil {
+		return err
+	}
+
+	err = os.Symlink(filepath.Dir(confPath), link)
+	if os.IsExist(err) && s.Option.bool(optionForce, optionForceDefault) {
+		return nil
+	}
+	return err
+}
+
+func (s *runit) Uninstall() error {
+	dir, err := s.serviceDir()
+	if err != nil {
+		return err
+	}
+	link, err := s.linkPath()
+	if err != nil {
+		return err
+	}
+	if _, err = os.Lstat(link); err == nil {
+		// Removing the link makes runsvdir stop supervising the service.
+		if err = run("sv", "down", link); err != nil {
+			warnf(s, "Uninstall failed to stop %s: %v", s.Name, err)
+		}
+		if err = os.Remove(link); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(dir)
+}
+
+func (s *runit) Logger(errs chan<- error) (Logger, error) {
+	if s.Config.Logger != nil {
+		return s.Config.Logger, nil
+	}
+	if system.Interactive() {
+		return ConsoleLogger, nil
+	}
+	return s.SystemLogger(errs)
+}
+func (s *runit) SystemLogger(errs chan<- error) (Logger, error) {
+	return newSysLogger(s.Name, errs)
+}
+
+func (s *runit) Run() (err error) {
+	err = s.i.Start(s)
+	if err != nil {
+		return err
+	}
+
+	stopReload := handleReload(s.i, s, s.Config)
+	s.Option.funcSingle(optionRunWait, func() {
+		var sigChan = make(chan os.Signal, 3)
+		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
+		<-sigChan
+	})()
+	stopReload()
+
+	return s.i.Stop(s)
+}
+
+// sv runs the sv command against the linked service directory.
+func (s *runit) sv(action string) error {
+	link, err := s.linkPath()
+	if err != nil {
+		return err
+	}
+	return run("sv", action, link)
+}
+
+func (s *runit) RunForeground() error {
+	return runForeground(s.i, s, s.Config)
+}
+
+func (s *runit) Start() error {
+	return s.sv("up")
+}
+
+func (s *runit) Stop() error {
+	return s.sv("down")
+}
+
+func (s *runit) Restart() error {
+	return s.sv("restart")
+}
+
+func (s *runit) Status() (Status, error) {
+	return s.checkHealth(s.status())
+}
+
+func (s *runit) status() (Status, error) {
+	link, err := s.linkPath()
+	if err != nil {
+		return StatusUnknown, err
+	}
+	if _, err = os.Lstat(link); err != nil {
+		return StatusUnknown, ErrNotInstalled
+	}
+	// Reports "run: <dir>: (pid 42) 5s" or "down: <dir>: 10s, normally up".
+	out, err := runWithOutput("sv", "status", link)
+	switch {
+	case strings.HasPrefix(out, "run:"):
+		return StatusRunning, nil
+	case strings.HasPrefix(out, "down:"), strings.HasPrefix(out, "finish:"):
+		return StatusStopped, nil
+	}
+	if err == nil {
+		err = fmt.Errorf("Unknown runit status %q for %s", out, s.Name)
+	}
+	return StatusUnknown, err
+}
+
+// runit supervises the process directly, so the run script must exec the
+// program in the foreground.
+const runitScript = `#!/bin/sh
+# {{.Description|oneLine}}
+exec 2>&1
+{{range $k, $v := .EnvVars}}export {{$k}}={{$v|shellQuote}}
+{{end}}{{if .WorkingDirectory}}cd {{.WorkingDirectory|shellQuote}} || exit 1{{end}}
+exec {{if or .UserName .ChRoot}}chpst {{if .UserName}}-u {{.UserName|shellQuote}} {{end}}{{if .ChRoot}}-/ {{.ChRoot|shellQuote}} {{end}}{{end}}{{.Path|shellQuote}}{{range .Arguments}} {{.|shellQuote}}{{end}}
+`
@@ -0,0 +1,88 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunitScript(t *testing.T) {
+	tests := []struct {
+		userName, chRoot string
+		exec             string
+	}{
+		{"", "", "\nexec '/usr/bin/app' 'a b'\n"},
+		{"app", "", "\nexec chpst -u 'app' '/usr/bin/app' 'a b'\n"},
+		{"app", "/srv/jail", "\nexec chpst -u 'app' -/ '/srv/jail' '/usr/bin/app' 'a b'\n"},
+	}
+	for _, tt := range tests {
+		s := &runit{Config: &Config{
+			Name:      "go_service_test",
+			Arguments: []string{"a b"},
+			UserName:  tt.userName,
+			ChRoot:    tt.chRoot,
+			EnvVars:   map[string]string{"APP_MODE": "prod"},
+		}}
+		b, err := s.script("/usr/bin/app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		script := string(b)
+		for _, line := range []string{"#!/bin/sh\n", "\nexport APP_MODE='prod'\n", tt.exec} {
+			if !strings.Contains(script, line) {
+				t.Errorf("UserName %q, ChRoot %q: script lacks %q:\n%s", tt.userName, tt.chRoot, line, script)
+			}
+		}
+	}
+}
+
+func TestRunitConfigPath(t *testing.T) {
+	s := &runit{Config: &Config{Name: "go_service_test"}}
+	if got, err := s.ConfigPath(); err != nil || got != "/etc/sv/go_service_test/run" {
+		t.Errorf("ConfigPath = %q, %v, want /etc/sv/go_service_test/run", got, err)
+	}
+	s.Option = KeyValue{optionUserService: true}
+	if _, err := s.ConfigPath(); err != errNoUserServiceRunit {
+		t.Errorf("ConfigPath of a user service = %v, want %v", err, errNoUserServiceRunit)
+	}
+}
+
+func TestRunitUninstallStopFails(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	dir, err := ioutil.TempDir("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// An sv that fails to stop the service.
+	if err = ioutil.WriteFile(filepath.Join(dir, "sv"), []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	saved := runitServiceDirs
+	defer func() { runitServiceDirs = saved }()
+	runitServiceDirs = [...]string{dir, dir}
+
+	link := filepath.Join(dir, "go_service_test_missing")
+	if err = os.Symlink(filepath.Join(dir, "missing"), link); err != nil {
+		t.Fatal(err)
+	}
+	s := &runit{Config: &Config{Name: "go_service_test_missing", Logger: ConsoleLogger}}
+	if err = s.Uninstall(); err != nil {
+		t.Fatalf("Uninstall = %v, want a failed stop to be only logged", err)
+	}
+	if _, err = os.Lstat(link); !os.IsNotExist(err) {
+		t.Errorf("link not removed: %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/template"
+)
+
+// s6ScanDirs lists the scan directories watched by s6-svscan, in the order
+// s6-linux-init, s6-overlay and classic installations use them.
+var s6ScanDirs = [...]string{"/run/service", "/var/run/s6/services", "/service"}
+
+func isS6(context.Context) bool {
+	for _, bin := range [...]string{"s6-svscan", "s6-svc", "s6-svstat"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			return false
+		}
+	}
+	for _, dir := range s6ScanDirs {
+		if _, err := os.Stat(dir); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+type s6 struct {
+	i Interface
+	*Config
+}
+
+func newS6Service(i Interface, c *Config) (Service, error) {
+	s := &s6{
+		i:      i,
+		Config: c,
+	}
+
+	return s, nil
+}
+
+func (s *s6) String() string {
+	if len(s.DisplayName) > 0 {
+		return s.DisplayName
+	}
+	return s.Name
+}
+
+var errNoUserServiceS6 error = userServiceError("s6")
+
+// serviceDir returns the directory holding the run script.
+func (s *s6) serviceDir() (string, error) {
+	if s.Option.bool(optionUserService, optionUserServiceDefault) {
+		return "", errNoUserServiceS6
+	}
+	return "/etc/s6/sv/" + s.Config.Name, nil
+}
+
+// configPath returns the path of the run script.
+func (s *s6) configPath() (cp string, err error) {
+	dir, err := s.serviceDir()
+	if err != nil {
+		return
+	}
+	cp = filepath.Join(dir, "run")
+	return
+}
+
+// scanDir returns the scan directory s6-svscan supervises.
+func (s *s6) scanDir() (string, error) {
+	for _, dir := range s6ScanDirs {
+		if _, err := os.Stat(dir); err == nil {
+			return dir, nil
+		}
+	}
+	return "", errors.New("No s6 scan directory found.")
+}
+
+// linkPath returns the path the service directory is linked to in order to
+// enable it.
+func (s *s6) linkPath() (string, error) {
+	dir, err := s.scanDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, s.Config.Name), nil
+}
+
+func (s *s6) template() *template.Template {
+	return template.Must(template.New("").Funcs(tf).Parse(s6Script))
+}
+
+// script renders the run script that runs the executable at path.
+func (s *s6) script(path string) ([]byte, error) {
+	env, err := s.expandEnvVars(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var to = &struct {
+		*Config
+		Path    string
+		EnvVars map[string]string
+	}{
+		Config:  s.Config,
+		Path:    path,
+		EnvVars: env,
+	}
+
+	var b bytes.Buffer
+	if err = s.template().Execute(&b, to); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// ConfigPath returns the service directory that holds the run script.
+func (s *s6) ConfigPath() (string, error) {
+	return s.configPath()
+}
+
+// Install creates the service directory, links it into the scan directory and
+// asks s6-svscan to pick it up, which starts the service.
+// When s6-rc manages the system the service is supervised directly and not
+// added to a compiled s6-rc database.
+func (s *s6) Install() error {
+	confPath, err := s.configPath()
+	if err != nil {
+		return err
+	}
+	if err = s.Validate(); err != nil {
+		return err
+	}
+	scanDir, err := s.scanDir()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(confPath), 0755); err != nil {
+		return err
+	}
+	path, err := s.installExecPath(confPath)
+	if err != nil {
+		return err
+	}
+
+	script, err := s.script(path)
+	if err != nil {
+		return err
+	}
+	f, err := createConfig(confPath, 0755, s.Option.bool(optionForce, optionForceDefault))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err = f.Write(script); err != nil {
+		return err
+	}
+	// The script must not be open for writing once the supervisor runs it.
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = restoreCon(s.Option, confPath); err != nil {
+		return err
+	}
+	if err = writeFinish(s.Option, filepath.Dir(confPath), "s6-svc -O", s.Config.Restart); err != nil {
+		return err
+	}
+
+	err = os.Symlink(filepath.Dir(confPath), filepath.Join(scanDir, s.Name))
+	if err != nil && !(os.IsExist(err) && s.Option.bool(optionForce, optionForceDefault)) {
+		return err
+	}
+	return run("s6-svscanctl", "-a", scanDir)
+}
+
+func (s *s6) Uninstall() error {
+	dir, err := s.serviceDir()
+	if err != nil {
+		return err
+	}
+	scanDir, err := s.scanDir()
+	if err != nil {
+		return err
+	}
+	link := filepath.Join(scanDir, s.Name)
+	if _, err = os.Lstat(link); err == nil {
+		if err = run("s6-svc", "-d", link); err != nil {
+			warnf(s, "Uninstall failed to stop %s: %v", s.Name, err)
+		}
+		if err = os.Remove(link); err != nil {
+			return err
+		}
+		// Rescan and drop the supervisor of the removed service.
+		if err = run("s6-svscanctl", "-an", scanDir); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(dir)
+}
+
+func (s *s6) Logger(errs chan<- error) (Logger, error) {
+	if s.Config.Logger != nil {
+		return s.Config.Logger, nil
+	}
+	if system.Interactive() {
+		return ConsoleLogger, nil
+	}
+	return s.SystemLogger(errs)
+}
+func (s *s6) SystemLogger(errs chan<- error) (Logger, error) {
+	return newSysLogger(s.Name, errs)
+}
+
+func (s *s6) Run() (err error) {
+	err = s.i.Start(s)
+	if err != nil {
+		return err
+	}
+
+	stopReload := handleReload(s.i, s, s.Config)
+	s.Option.funcSingle(optionRunWait, func() {
+		var sigChan = make(chan os.Signal, 3)
+		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
+		<-sigChan
+	})()
+	stopReload()
+
+	return s.i.Stop(s)
+}
+
+// svc runs s6-svc with the given flag against the linked service directory.
+func (s *s6) svc(flag string) error {
+	link, err := s.linkPath()
+	if err != nil {
+		return err
+	}
+	return run("s6-svc", flag, link)
+}
+
+func (s *s6) RunForeground() error {
+	return runForeground(s.i, s, s.Config)
+}
+
+func (s *s6) Start() error {
+	return s.svc("-u")
+}
+
+func (s *s6) Stop() error {
+	return s.svc("-d")
+}
+
+func (s *s6) Restart() error {
+	return s.svc("-r")
+}
+
+func (s *s6) Status() (Status, error) {
+	return s.checkHealth(s.status())
+}
+
+func (s *s6) status() (Status, error) {
+	link, err := s.linkPath()
+	if err != nil {
+		return StatusUnknown, err
+	}
+	if _, err = os.Lstat(link); err != nil {
+		return StatusUnknown, ErrNotInstalled
+	}
+	// Reports "up (pid 42) 5 seconds" or "down (exitcode 0) 10 seconds, normally up".
+	out, err := runWithOutput("s6-svstat", link)
+	switch {
+	case strings.HasPrefix(out, "up"):
+		return StatusRunning, nil
+	case strings.HasPrefix(out, "down"):
+		return StatusStopped, nil
+	}
+	if err == nil {
+		err = fmt.Errorf("Unknown s6 status %q for %s", out, s.Name)
+	}
+	return StatusUnknown, err
+}
+
+// s6-supervise runs the process directly, so the run script must exec the
+// program in the foreground. With ChRoot the script drops privileges with the
+// --userspec flag of chroot, which GNU coreutils has and busybox lacks, as
+// s6-setuidgid would have to be present inside the chroot.
+const s6Script = `#!/bin/sh
+# {{.Description|oneLine}}
+exec 2>&1
+{{range $k, $v := .EnvVars}}export {{$k}}={{$v|shellQuote}}
+{{end}}{{if .WorkingDirectory}}cd {{.WorkingDirectory|shellQuote}} || exit 1{{end}}
+{{if .ChRoot}}exec chroot {{if .UserName}}--userspec={{.UserName|shellQuote}} {{end}}{{.ChRoot|shellQuote}} {{else if .UserName}}exec s6-setuidgid {{.UserName|shellQuote}} {{else}}exec {{end}}{{.Path|shellQuote}}{{range .Arguments}} {{.|shellQuote}}{{end}}
+`
@@ -0,0 +1,101 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestS6Script(t *testing.T) {
+	tests := []struct {
+		userName, chRoot string
+		exec             string
+	}{
+		{"", "", "\nexec '/usr/bin/app' 'a b'\n"},
+		{"app", "", "\nexec s6-setuidgid 'app' '/usr/bin/app' 'a b'\n"},
+		{"app", "/srv/jail", "\nexec chroot --userspec='app' '/srv/jail' '/usr/bin/app' 'a b'\n"},
+	}
+	for _, tt := range tests {
+		s := &s6{Config: &Config{
+			Name:      "go_service_test",
+			Arguments: []string{"a b"},
+			UserName:  tt.userName,
+			ChRoot:    tt.chRoot,
+			EnvVars:   map[string]string{"APP_MODE": "prod"},
+		}}
+		b, err := s.script("/usr/bin/app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		script := string(b)
+		for _, line := range []string{"#!/bin/sh\n", "\nexport APP_MODE='prod'\n", tt.exec} {
+			if !strings.Contains(script, line) {
+				t.Errorf("UserName %q, ChRoot %q: script lacks %q:\n%s", tt.userName, tt.chRoot, line, script)
+			}
+		}
+	}
+}
+
+func TestS6ConfigPath(t *testing.T) {
+	s := &s6{Config: &Config{Name: "go_service_test"}}
+	if got, err := s.ConfigPath(); err != nil || got != "/etc/s6/sv/go_service_test/run" {
+		t.Errorf("ConfigPath = %q, %v, want /etc/s6/sv/go_service_test/run", got, err)
+	}
+	s.Option = KeyValue{optionUserService: true}
+	if _, err := s.ConfigPath(); err != errNoUserServiceS6 {
+		t.Errorf("ConfigPath of a user service = %v, want %v", err, errNoUserServiceS6)
+	}
+}
+
+func TestS6Uninstall(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	dir, err := ioutil.TempDir("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// s6 tools that record their commands, failing to stop the service.
+	calls := filepath.Join(dir, "calls")
+	for name, script := range map[string]string{
+		"s6-svc":       "#!/bin/sh\necho s6-svc \"$1\" >> " + calls + "\nexit 1\n",
+		"s6-svscanctl": "#!/bin/sh\necho s6-svscanctl \"$1\" >> " + calls + "\n",
+	} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	saved := s6ScanDirs
+	defer func() { s6ScanDirs = saved }()
+	s6ScanDirs = [...]string{dir, dir, dir}
+
+	link := filepath.Join(dir, "go_service_test_missing")
+	if err = os.Symlink(filepath.Join(dir, "missing"), link); err != nil {
+		t.Fatal(err)
+	}
+	s := &s6{Config: &Config{Name: "go_service_test_missing", Logger: ConsoleLogger}}
+	if err = s.Uninstall(); err != nil {
+		t.Fatalf("Uninstall = %v, want a failed stop to be only logged", err)
+	}
+	if _, err = os.Lstat(link); !os.IsNotExist(err) {
+		t.Errorf("link not removed: %v", err)
+	}
+	b, err := ioutil.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(b)); got != "s6-svc -d\ns6-svscanctl -an" {
+		t.Errorf("s6 tools called with %q, want s6-svc -d and s6-svscanctl -an", got)
+	}
+}
@@ -5,26 +5,35 @@
 package service
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"text/template"
+	"time"
 )
 
-func isSystemd() bool {
+func isSystemd(context.Context) bool {
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return false
+	}
 	if _, err := os.Stat("/run/systemd/system"); err == nil {
 		return true
 	}
 	return false
 }
 
-type systemd struct {
-	i Interface
-	*Config
-}
-
 func newSystemdService(i Interface, c *Config) (Service, error) {
 	s := &systemd{
 		i:      i,
@@ -41,75 +50,333 @@ func (s *systemd) String() string {
 	return s.Name
 }
 
-// Systemd services should be supported, but are not currently.
-var errNoUserServiceSystemd = errors.New("User services are not supported on systemd.")
-
 func (s *systemd) configPath() (cp string, err error) {
-	if s.Option.bool(optionUserService, optionUserServiceDefault) {
-		err = errNoUserServiceSystemd
+	switch scope := s.Option.string(optionManagerScope, optionManagerScopeDefault); scope {
+	case "system", "user":
+	default:
+		err = fmt.Errorf("Unknown systemd manager scope: %q", scope)
 		return
 	}
-	cp = "/etc/systemd/system/" + s.Config.Name + ".service"
+	if dir := s.Option.string(optionUnitDir, ""); len(dir) != 0 {
+		cp = filepath.Join(dir, s.Config.Name+".service")
+		return
+	}
+	if root := s.Option.string(optionTargetRoot, ""); len(root) != 0 {
+		if s.isUserService() {
+			err = fmt.Errorf("The %s option does not support user services", optionTargetRoot)
+			return
+		}
+		cp = filepath.Join(root, "etc", "systemd", "system", s.Config.Name+".service")
+		return
+	}
+	if !s.isUserService() {
+		cp = "/etc/systemd/system/" + s.Config.Name + ".service"
+		return
+	}
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if len(configDir) == 0 {
+		homeDir := os.Getenv("HOME")
+		if len(homeDir) == 0 {
+			err = errors.New("User home directory not found.")
+			return
+		}
+		configDir = filepath.Join(homeDir, ".config")
+	}
+	cp = filepath.Join(configDir, "systemd", "user", s.Config.Name+".service")
 	return
 }
-func (s *systemd) template() *template.Template {
-	return template.Must(template.New("").Funcs(tf).Parse(systemdScript))
+
+// systemctl returns a systemctl command addressed to the manager the
+// service is installed in. The user manager is reached through
+// $DBUS_SESSION_BUS_ADDRESS, falling back to the bus socket in
+// $XDG_RUNTIME_DIR (or /run/user/<uid>) as found in rootless containers.
+func (s *systemd) systemctl(args ...string) *exec.Cmd {
+	if !s.isUserService() {
+		return exec.Command("systemctl", args...)
+	}
+	cmd := exec.Command("systemctl", append([]string{"--user"}, args...)...)
+	cmd.Env = os.Environ()
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if len(runtimeDir) == 0 {
+		runtimeDir = "/run/user/" + strconv.Itoa(os.Getuid())
+		cmd.Env = append(cmd.Env, "XDG_RUNTIME_DIR="+runtimeDir)
+	}
+	if len(os.Getenv("DBUS_SESSION_BUS_ADDRESS")) == 0 {
+		cmd.Env = append(cmd.Env, "DBUS_SESSION_BUS_ADDRESS=unix:path="+filepath.Join(runtimeDir, "bus"))
+	}
+	return cmd
+}
+
+func (s *systemd) ConfigPath() (string, error) {
+	return s.configPath()
 }
 
 func (s *systemd) Install() error {
+	return s.install(!s.Option.bool(optionSkipDaemonReload, optionSkipDaemonReloadDefault))
+}
+
+// install writes and enables the unit, reloading the manager if reload is set
+// and the unit changed.
+func (s *systemd) install(reload bool) error {
 	confPath, err := s.configPath()
 	if err != nil {
 		return err
 	}
-	_, err = os.Stat(confPath)
-	if err == nil {
-		return fmt.Errorf("Init already exists: %s", confPath)
+	if err = s.Validate(); err != nil {
+		return err
+	}
+	root := s.Option.string(optionTargetRoot, "")
+	if s.isUserService() || len(root) != 0 {
+		// Ensure that the user or target unit directory exists.
+		err = os.MkdirAll(filepath.Dir(confPath), 0755)
+		if err != nil {
+			return err
+		}
 	}
 
-	f, err := os.Create(confPath)
+	// A forced install may rewrite the unit unchanged, which needs no reload.
+	prior, priorErr := ioutil.ReadFile(confPath)
+
+	path, err := s.installExecPath(confPath)
+	if err != nil {
+		return err
+	}
+	typ := serviceType(s.Option)
+	if typ == "exec" && len(root) == 0 {
+		if v, err := systemdVersion(); err == nil && v < execTypeVersion {
+			s.warnf("systemd %d does not support Type=exec, installing %s as Type=simple", v, s.Name)
+			typ = "simple"
+		}
+	}
+	unit, err := s.unit(path, typ)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	path, err := s.execPath()
+	f, err := createConfig(confPath, 0644, s.Option.bool(optionForce, optionForceDefault))
 	if err != nil {
 		return err
 	}
+	defer f.Close()
+
+	if _, err = f.Write(unit); err != nil {
+		return err
+	}
+	if err = restoreCon(s.Option, confPath); err != nil {
+		return err
+	}
+	changed := priorErr != nil || !bytes.Equal(prior, unit)
+	for i := range s.Sockets {
+		socketChanged, err := s.installSocket(filepath.Dir(confPath), i)
+		if err != nil {
+			return err
+		}
+		changed = changed || socketChanged
+	}
+
+	if len(s.Option.string(optionUnitDir, "")) != 0 {
+		// systemd does not read the unit from there.
+		return nil
+	}
+	if s.Option.bool(optionAutoEnable, optionAutoEnableDefault) {
+		err = runCommand(s.systemctl(append(s.rootArgs("enable", s.Name+".service"), s.socketUnits()...)...))
+		if err != nil {
+			return err
+		}
+	}
+	if !reload || !changed || len(root) != 0 {
+		return nil
+	}
+	return s.DaemonReload()
+}
+
+// UninstallPlan describes, one step per line, what Uninstall would do given
+// the installed unit, without doing any of it. It notes whether the service is
+// running, and so would be stopped.
+func (s *systemd) UninstallPlan() (string, error) {
+	cp, err := s.configPath()
+	if err != nil {
+		return "", err
+	}
+	if _, err = os.Stat(cp); err != nil {
+		return "", ErrNotInstalled
+	}
+	var plan []string
+	if len(s.Option.string(optionUnitDir, "")) == 0 {
+		if len(s.Option.string(optionTargetRoot, "")) == 0 {
+			if status, err := s.status(); err == nil && status == StatusRunning {
+				plan = append(plan, "Stop "+s.Name+".service, which is running")
+			}
+		}
+		plan = append(plan, "Run systemctl "+strings.Join(append(s.rootArgs("disable", s.Name+".service"), s.socketUnits()...), " "))
+	}
+	if s.Option.bool(optionKeepFile, optionKeepFileDefault) {
+		plan = append(plan, "Keep "+cp)
+		return strings.Join(plan, "\n"), nil
+	}
+	dir := filepath.Dir(cp)
+	for _, unit := range s.socketUnits() {
+		if _, err := os.Stat(filepath.Join(dir, unit)); err == nil {
+			plan = append(plan, "Remove "+filepath.Join(dir, unit))
+		}
+	}
+	for _, alias := range s.aliases() {
+		link := filepath.Join(dir, alias)
+		if fi, err := os.Lstat(link); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			plan = append(plan, "Remove "+link)
+		}
+	}
+	plan = append(plan, "Remove "+cp)
+	return strings.Join(plan, "\n"), nil
+}
+
+// stopRunning stops the unit if it is running, so that Uninstall does not
+// leave its process behind. A failure to stop is logged, not returned.
+func (s *systemd) stopRunning() {
+	if status, err := s.status(); err != nil || status != StatusRunning {
+		return
+	}
+	if err := s.Stop(); err != nil {
+		s.warnf("Uninstall failed to stop %s: %v", s.Name, err)
+	}
+}
+
+// warnf logs a warning about a step that did not stop Install or Uninstall.
+func (s *systemd) warnf(format string, a ...interface{}) {
+	warnf(s, format, a...)
+}
+
+// execTypeVersion is the first systemd version to support Type=exec.
+const execTypeVersion = 240
+
+// systemdVersion returns the version of the host's systemd.
+func systemdVersion() (int, error) {
+	out, err := runWithOutput("systemctl", "--version")
+	if err != nil {
+		return 0, err
+	}
+	return parseSystemdVersion(out)
+}
+
+// parseSystemdVersion parses the output of systemctl --version, which starts
+// "systemd 245 (245.4-4ubuntu3)".
+func parseSystemdVersion(out string) (int, error) {
+	fields := strings.Fields(out)
+	if len(fields) < 2 || fields[0] != "systemd" {
+		return 0, fmt.Errorf("Unexpected systemctl --version output: %q", out)
+	}
+	v, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, fmt.Errorf("Unexpected systemctl --version output: %q", out)
+	}
+	return v, nil
+}
+
+// rootArgs returns args preceded by the --root flag for the TargetRoot
+// option, if set, so that systemctl enable and disable act on that system.
+func (s *systemd) rootArgs(args ...string) []string {
+	if root := s.Option.string(optionTargetRoot, ""); len(root) != 0 {
+		return append([]string{"--root=" + root}, args...)
+	}
+	return args
+}
+
+// socketUnits returns the names of the socket units for Config.Sockets.
+func (s *systemd) socketUnits() []string {
+	units := make([]string, len(s.Sockets))
+	for i := range s.Sockets {
+		units[i] = s.Name + ".socket"
+		if i != 0 {
+			units[i] = s.Name + "-" + strconv.Itoa(i) + ".socket"
+		}
+	}
+	return units
+}
+
+// installSocket writes the socket unit for the socket at index i of
+// Config.Sockets into dir and reports whether its content changed.
+func (s *systemd) installSocket(dir string, i int) (bool, error) {
+	path := filepath.Join(dir, s.socketUnits()[i])
+	prior, priorErr := ioutil.ReadFile(path)
+	f, err := createConfig(path, 0644, s.Option.bool(optionForce, optionForceDefault))
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
 
 	var to = &struct {
 		*Config
-		Path         string
-		ReloadSignal string
-		PIDFile      string
+		SocketConfig
 	}{
-		s.Config,
-		path,
-		s.Option.string(optionReloadSignal, ""),
-		s.Option.string(optionPIDFile, ""),
+		Config:       s.Config,
+		SocketConfig: s.Sockets[i],
 	}
-
-	err = s.template().Execute(f, to)
+	var b bytes.Buffer
+	err = template.Must(template.New("").Funcs(tf).Parse(systemdSocketScript)).Execute(&b, to)
 	if err != nil {
-		return err
+		return false, err
+	}
+	if _, err = f.Write(b.Bytes()); err != nil {
+		return false, err
+	}
+	if err = restoreCon(s.Option, path); err != nil {
+		return false, err
 	}
+	return priorErr != nil || !bytes.Equal(prior, b.Bytes()), nil
+}
 
-	err = run("systemctl", "enable", s.Name+".service")
-	if err != nil {
-		return err
+// reloadScope identifies the manager instance DaemonReload reloads.
+func (s *systemd) reloadScope() string {
+	if s.isUserService() {
+		return "user"
 	}
-	return run("systemctl", "daemon-reload")
+	return "system"
+}
+
+// DaemonReload makes the service manager reload all unit files, as needed
+// after installing with the SkipDaemonReload option.
+func (s *systemd) DaemonReload() error {
+	return runCommand(s.systemctl("daemon-reload"))
+}
+
+// DaemonReexec makes the service manager re-execute itself, as needed after
+// upgrading systemd or changing manager settings.
+func (s *systemd) DaemonReexec() error {
+	return runCommand(s.systemctl("daemon-reexec"))
 }
 
 func (s *systemd) Uninstall() error {
-	err := run("systemctl", "disable", s.Name+".service")
-	if err != nil {
-		return err
+	if len(s.Option.string(optionUnitDir, "")) == 0 {
+		if len(s.Option.string(optionTargetRoot, "")) == 0 {
+			s.stopRunning()
+		}
+		err := runCommand(s.systemctl(append(s.rootArgs("disable", s.Name+".service"), s.socketUnits()...)...))
+		if err != nil {
+			return err
+		}
+	}
+	if s.Option.bool(optionKeepFile, optionKeepFileDefault) {
+		return nil
 	}
 	cp, err := s.configPath()
 	if err != nil {
 		return err
 	}
+	for _, unit := range s.socketUnits() {
+		if err = os.Remove(filepath.Join(filepath.Dir(cp), unit)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	// Disable removes the alias links it created, but not ones left over
+	// from a unit that was never enabled.
+	for _, alias := range s.aliases() {
+		link := filepath.Join(filepath.Dir(cp), alias)
+		if fi, err := os.Lstat(link); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			if err = os.Remove(link); err != nil {
+				return err
+			}
+		}
+	}
 	if err := os.Remove(cp); err != nil {
 		return err
 	}
@@ -117,6 +384,9 @@ func (s *systemd) Uninstall() error {
 }
 
 func (s *systemd) Logger(errs chan<- error) (Logger, error) {
+	if s.Config.Logger != nil {
+		return s.Config.Logger, nil
+	}
 	if system.Interactive() {
 		return ConsoleLogger, nil
 	}
@@ -132,44 +402,665 @@ func (s *systemd) Run() (err error) {
 		return err
 	}
 
+	stopReload := handleReload(s.i, s, s.Config)
 	s.Option.funcSingle(optionRunWait, func() {
 		var sigChan = make(chan os.Signal, 3)
 		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
 		<-sigChan
 	})()
+	stopReload()
 
 	return s.i.Stop(s)
 }
 
+func (s *systemd) RunForeground() error {
+	return runForeground(s.i, s, s.Config)
+}
+
 func (s *systemd) Start() error {
-	return run("systemctl", "start", s.Name+".service")
+	return runCommand(s.systemctl("start", s.Name+".service"))
 }
 
 func (s *systemd) Stop() error {
-	return run("systemctl", "stop", s.Name+".service")
+	return runCommand(s.systemctl("stop", s.Name+".service"))
 }
 
 func (s *systemd) Restart() error {
-	return run("systemctl", "restart", s.Name+".service")
-}
-
-const systemdScript = `[Unit]
-Description={{.Description}}
-ConditionFileIsExecutable={{.Path|cmdEscape}}
-
-[Service]
-StartLimitInterval=5
-StartLimitBurst=10
-ExecStart={{.Path|cmdEscape}}{{range .Arguments}} {{.|cmd}}{{end}}
-{{if .ChRoot}}RootDirectory={{.ChRoot|cmd}}{{end}}
-{{if .WorkingDirectory}}WorkingDirectory={{.WorkingDirectory|cmdEscape}}{{end}}
-{{if .UserName}}User={{.UserName}}{{end}}
-{{if .ReloadSignal}}ExecReload=/bin/kill -{{.ReloadSignal}} "$MAINPID"{{end}}
-{{if .PIDFile}}PIDFile={{.PIDFile|cmd}}{{end}}
-Restart=always
-RestartSec=120
-EnvironmentFile=-/etc/sysconfig/{{.Name}}
+	err := runCommand(s.systemctl("restart", s.Name+".service"))
+	if err != nil {
+		return err
+	}
+	wait := s.Option.string(optionRestartWait, "")
+	if len(wait) == 0 {
+		return nil
+	}
+	d, err := time.ParseDuration(wait)
+	if err != nil {
+		return err
+	}
+	return s.verifyRestart(d)
+}
+
+// restartPollInterval is how often Restart and ReloadAndWait query the unit
+// state while they wait.
+var restartPollInterval = 250 * time.Millisecond
+
+// verifyRestart returns an error as soon as the unit fails within d of a
+// restart, or if it is not active once d has passed.
+func (s *systemd) verifyRestart(d time.Duration) error {
+	deadline := time.Now().Add(d)
+	for {
+		st, err := s.unitState()
+		if err != nil {
+			return err
+		}
+		done := !time.Now().Before(deadline)
+		if err = restartError(st, done); err != nil || done {
+			return err
+		}
+		time.Sleep(restartPollInterval)
+	}
+}
+
+// restartError returns an error if the unit state shows a failed restart. A
+// unit that is still starting is only an error once done.
+func restartError(st unitState, done bool) error {
+	switch {
+	case st.ActiveState == "failed", st.SubState == "auto-restart":
+		return fmt.Errorf("Unit failed after restart: %s (%s)", st.ActiveState, st.SubState)
+	case done && (st.ActiveState != "active" || unitStatus(st) != StatusRunning):
+		return fmt.Errorf("Unit not active after restart: %s (%s)", st.ActiveState, st.SubState)
+	}
+	return nil
+}
+
+// ReloadAndWait reloads the unit through its ExecReload= and waits until it is
+// active and running again, as once a service that sent RELOADING=1 through
+// sd_notify sends READY=1. It returns an error as soon as the unit fails, or
+// once ctx is done while the unit is still reloading.
+func (s *systemd) ReloadAndWait(ctx context.Context) error {
+	err := runCommand(s.systemctl("reload", s.Name+".service"))
+	if err != nil {
+		return err
+	}
+	for {
+		st, err := s.unitState()
+		if err != nil {
+			return err
+		}
+		if done, err := reloadDone(st); done {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Unit still reloading: %s (%s): %v", st.ActiveState, st.SubState, ctx.Err())
+		case <-time.After(restartPollInterval):
+		}
+	}
+}
+
+// reloadDone reports whether the unit state ends a reload, with an error if
+// the unit failed.
+func reloadDone(st unitState) (bool, error) {
+	switch {
+	case st.ActiveState == "failed", st.SubState == "auto-restart":
+		return true, fmt.Errorf("Unit failed after reload: %s (%s)", st.ActiveState, st.SubState)
+	case st.ActiveState == "active" && st.SubState == "running":
+		return true, nil
+	}
+	return false, nil
+}
+
+func (s *systemd) Status() (Status, error) {
+	return s.checkHealth(s.status())
+}
+
+// activeStatus maps a systemd ActiveState to a Status.
+func activeStatus(state string) Status {
+	switch state {
+	case "active", "activating", "deactivating", "reloading":
+		return StatusRunning
+	case "failed":
+		return StatusFailed
+	case "inactive":
+		return StatusStopped
+	}
+	return StatusUnknown
+}
+
+func (s *systemd) status() (Status, error) {
+	st, err := s.unitState()
+	if err != nil {
+		return StatusUnknown, err
+	}
+	if st.LoadState == "not-found" {
+		return StatusUnknown, ErrNotInstalled
+	}
+	status := unitStatus(st)
+	if status == StatusUnknown {
+		return StatusUnknown, fmt.Errorf("Unknown systemd state %q for %s", st.ActiveState, s.Name)
+	}
+	return status, nil
+}
+
+// unitStatus maps the state of a unit to a Status. A unit that is active with
+// its process exited has completed successfully if it remains after exit, as
+// a oneshot service with RemainAfterExit does; otherwise it is stopping.
+func unitStatus(st unitState) Status {
+	status := activeStatus(st.ActiveState)
+	if status == StatusRunning && st.SubState == "exited" && !st.RemainAfterExit {
+		return StatusStopped
+	}
+	return status
+}
+
+// unitState holds the state of a unit as reported by systemctl show.
+type unitState struct {
+	LoadState   string // Such as "loaded" or "not-found".
+	ActiveState string // Such as "active", "inactive" or "failed".
+	SubState    string // Such as "running", "exited" or "dead".
+	MainPID     int
+
+	Type            string // Such as "simple" or "oneshot".
+	RemainAfterExit bool
+}
+
+func (s *systemd) unitState() (unitState, error) {
+	out, err := runCommandWithOutput(s.systemctl("show", s.Name+".service",
+		"--property=LoadState,ActiveState,SubState,MainPID,Type,RemainAfterExit"))
+	if err != nil {
+		return unitState{}, err
+	}
+	return parseUnitState(out)
+}
+
+// parseUnitState parses the key=value output of systemctl show.
+func parseUnitState(out string) (unitState, error) {
+	props := parseProperties(out)
+	st := unitState{
+		LoadState:   props["LoadState"],
+		ActiveState: props["ActiveState"],
+		SubState:    props["SubState"],
+
+		Type:            props["Type"],
+		RemainAfterExit: props["RemainAfterExit"] == "yes",
+	}
+	if len(st.LoadState) == 0 || len(st.ActiveState) == 0 {
+		return st, fmt.Errorf("Unexpected systemctl show output: %q", out)
+	}
+	if pid, found := props["MainPID"]; found {
+		var err error
+		if st.MainPID, err = strconv.Atoi(pid); err != nil {
+			return st, fmt.Errorf("Invalid MainPID %q: %v", pid, err)
+		}
+	}
+	return st, nil
+}
+
+// listenFDsStart is the first file descriptor systemd passes a socket in.
+const listenFDsStart = 3
+
+// Listeners returns the sockets passed to the process by systemd socket
+// activation, keyed by the FileDescriptorName of their SocketConfig. A socket
+// without one goes by its unit name, such as "app.socket", or by its position,
+// such as "0", if systemd passed no names. The map is empty when the process
+// was not socket activated. The LISTEN_* variables are unset so that child
+// processes do not take the sockets for their own.
+func Listeners() (map[string]net.Listener, error) {
+	names, err := listenFDNames(os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES"), os.Getpid())
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if err != nil {
+		return nil, err
+	}
+	listeners := make(map[string]net.Listener, len(names))
+	for i, name := range names {
+		fd := listenFDsStart + i
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Socket %s: %v", name, err)
+		}
+		listeners[name] = l
+	}
+	return listeners, nil
+}
+
+// listenFDNames returns the names of the sockets systemd passed, as given by
+// the LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES variables, or none if they
+// were meant for another process than pid.
+func listenFDNames(listenPID, fds, fdNames string, pid int) ([]string, error) {
+	if listenPID != strconv.Itoa(pid) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("Invalid LISTEN_FDS %q", fds)
+	}
+	names := strings.Split(fdNames, ":")
+	if len(fdNames) == 0 || len(names) != n {
+		names = make([]string, n)
+		for i := range names {
+			names[i] = strconv.Itoa(i)
+		}
+	}
+	return names, nil
+}
+
+// StatusAll returns the status of the named system services, as for a
+// dashboard listing many of them, with a single systemctl call. A service that
+// is not installed has StatusUnknown, and no HealthCheck is run. If the batched
+// call fails, each service is queried in turn.
+func StatusAll(names []string) (map[string]Status, error) {
+	statuses := make(map[string]Status, len(names))
+	if len(names) == 0 {
+		return statuses, nil
+	}
+	args := []string{"show", "--property=LoadState,ActiveState,SubState,MainPID,Type,RemainAfterExit"}
+	for _, name := range names {
+		args = append(args, name+".service")
+	}
+	out, err := runCommandWithOutput(exec.Command("systemctl", args...))
+	if err == nil {
+		states, err := parseUnitStates(out)
+		if err == nil && len(states) == len(names) {
+			for i, st := range states {
+				statuses[names[i]] = StatusUnknown
+				if st.LoadState != "not-found" {
+					statuses[names[i]] = unitStatus(st)
+				}
+			}
+			return statuses, nil
+		}
+	}
+	for _, name := range names {
+		s := &systemd{Config: &Config{Name: name}}
+		status, err := s.status()
+		if err != nil && err != ErrNotInstalled {
+			return nil, err
+		}
+		statuses[name] = status
+	}
+	return statuses, nil
+}
+
+// parseUnitStates parses the output of systemctl show for several units, in
+// which the properties of each unit are separated by a blank line.
+func parseUnitStates(out string) ([]unitState, error) {
+	var states []unitState
+	for _, block := range strings.Split(out, "\n\n") {
+		st, err := parseUnitState(block)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, st)
+	}
+	return states, nil
+}
+
+// show returns the given unit properties as reported by systemctl show.
+func (s *systemd) show(properties ...string) (map[string]string, error) {
+	out, err := runCommandWithOutput(s.systemctl("show", s.Name+".service", "--property="+strings.Join(properties, ",")))
+	if err != nil {
+		return nil, err
+	}
+	return parseProperties(out), nil
+}
+
+// parseProperties parses the key=value lines printed by systemctl show.
+func parseProperties(out string) map[string]string {
+	props := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		if i := strings.IndexByte(line, '='); i > 0 {
+			props[line[:i]] = line[i+1:]
+		}
+	}
+	return props
+}
+
+// Usage is the resource usage systemd accounts to a unit.
+type Usage struct {
+	MemoryCurrent uint64 // Memory in use, in bytes.
+	CPUUsageNSec  uint64 // CPU time consumed, in nanoseconds.
+}
+
+// ResourceUsage returns the current memory and CPU usage of the unit. A field
+// is zero when its accounting is not enabled for the unit, as the
+// EnableAccounting option does.
+func (s *systemd) ResourceUsage() (*Usage, error) {
+	props, err := s.show("LoadState", "MemoryCurrent", "CPUUsageNSec")
+	if err != nil {
+		return nil, err
+	}
+	if props["LoadState"] == "not-found" {
+		return nil, ErrNotInstalled
+	}
+	return &Usage{
+		MemoryCurrent: parseAccounting(props["MemoryCurrent"]),
+		CPUUsageNSec:  parseAccounting(props["CPUUsageNSec"]),
+	}, nil
+}
+
+// ControlGroup returns the cgroup path systemd assigned to the running unit,
+// relative to the cgroup mount, such as "/system.slice/NAME.service".
+func (s *systemd) ControlGroup() (string, error) {
+	props, err := s.show("LoadState", "ControlGroup")
+	if err != nil {
+		return "", err
+	}
+	if props["LoadState"] == "not-found" {
+		return "", ErrNotInstalled
+	}
+	cg := props["ControlGroup"]
+	if len(cg) == 0 {
+		return "", fmt.Errorf("No control group assigned to %s, it is not running", s.Name)
+	}
+	return cg, nil
+}
+
+// FragmentPath returns the unit file systemd loaded for the service, which
+// may not be the one Install wrote when another location shadows it.
+func (s *systemd) FragmentPath() (string, error) {
+	props, err := s.show("LoadState", "FragmentPath")
+	if err != nil {
+		return "", err
+	}
+	if props["LoadState"] == "not-found" {
+		return "", ErrNotInstalled
+	}
+	return props["FragmentPath"], nil
+}
+
+// InvocationID returns the ID systemd gave the current run of the unit, as
+// recorded in the _SYSTEMD_INVOCATION_ID field of its journal entries. It is
+// empty when the unit is not active.
+func (s *systemd) InvocationID() (string, error) {
+	props, err := s.show("LoadState", "ActiveState", "InvocationID")
+	if err != nil {
+		return "", err
+	}
+	if props["LoadState"] == "not-found" {
+		return "", ErrNotInstalled
+	}
+	if props["ActiveState"] != "active" && props["ActiveState"] != "reloading" {
+		return "", nil
+	}
+	return props["InvocationID"], nil
+}
+
+// parseAccounting parses an accounting property. systemd reports one that is
+// not tracked as "[not set]", or as (uint64)-1 in older versions.
+func parseAccounting(v string) uint64 {
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil || n == math.MaxUint64 {
+		return 0
+	}
+	return n
+}
+
+// VerifyExecPath checks that the commands the installed unit starts, as
+// loaded by systemd, still exist and are executable, as they may not after
+// the program moved.
+func (s *systemd) VerifyExecPath() error {
+	out, err := runCommandWithOutput(s.systemctl("show", s.Name+".service",
+		"--property=LoadState,ExecStart"))
+	if err != nil {
+		return err
+	}
+	if parseProperties(out)["LoadState"] == "not-found" {
+		return ErrNotInstalled
+	}
+	paths := parseExecPaths(out)
+	if len(paths) == 0 {
+		return fmt.Errorf("No ExecStart found for %s", s.Name)
+	}
+	for _, path := range paths {
+		fi, err := os.Stat(filepath.Join(s.ChRoot, path))
+		if err != nil {
+			return fmt.Errorf("ExecStart of %s: %v", s.Name, err)
+		}
+		if fi.IsDir() || fi.Mode()&0111 == 0 {
+			return fmt.Errorf("ExecStart of %s: %s is not executable", s.Name, path)
+		}
+	}
+	return nil
+}
+
+// parseExecPaths returns the path of each command in the ExecStart lines
+// printed by systemctl show, such as
+// "ExecStart={ path=/usr/bin/app ; argv[]=/usr/bin/app -v ; ... }".
+func parseExecPaths(out string) []string {
+	var paths []string
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.HasPrefix(line, "ExecStart=") {
+			continue
+		}
+		for _, field := range strings.Split(line, " ; ") {
+			if i := strings.Index(field, "path="); i >= 0 {
+				paths = append(paths, field[i+len("path="):])
+				break
+			}
+		}
+	}
+	return paths
+}
+
+// journalTime is the timestamp format journalctl parses, in local time.
+const journalTime = "2006-01-02 15:04:05"
+
+// LogsBetween returns the journal entries of the unit logged from start until
+// end. The output of journalctl is streamed; closing the reader stops it.
+func (s *systemd) LogsBetween(start, end time.Time) (io.ReadCloser, error) {
+	if _, err := exec.LookPath("journalctl"); err != nil {
+		return nil, err
+	}
+	unit := "--unit=" + s.Name + ".service"
+	args := []string{"--no-pager", "--output=short-iso"}
+	if s.isUserService() {
+		unit = "--user-unit=" + s.Name + ".service"
+		args = append(args, "--user")
+	}
+	args = append(args, unit,
+		"--since="+start.Local().Format(journalTime),
+		"--until="+end.Local().Format(journalTime))
+	cmd := exec.Command("journalctl", args...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &cmdReader{ReadCloser: out, cmd: cmd}, nil
+}
+
+// cmdReader reads the output of a started command.
+type cmdReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+// Close stops the command if it is still running and waits for it to exit.
+func (r *cmdReader) Close() error {
+	r.ReadCloser.Close()
+	r.cmd.Process.Kill()
+	r.cmd.Wait()
+	return nil
+}
+
+// StateChange describes a transition of a systemd unit between states.
+type StateChange struct {
+	Status      Status // Status corresponding to ActiveState.
+	ActiveState string // Such as "active", "inactive" or "failed".
+	SubState    string // Such as "running", "exited" or "dead".
+}
+
+// subscribeInterval is how often Subscribe queries the unit state.
+var subscribeInterval = time.Second
+
+// Subscribe sends the current state of the unit and then every change to it
+// on the returned channel until ctx is done, after which the channel is closed.
+// This package carries no DBus client, so the state is polled through
+// systemctl rather than delivered by PropertiesChanged signals; only actual
+// transitions are sent.
+func (s *systemd) Subscribe(ctx context.Context) (<-chan StateChange, error) {
+	last, err := s.stateChange()
+	if err != nil {
+		return nil, err
+	}
+	changes := make(chan StateChange)
+	go func() {
+		defer close(changes)
+		tick := time.NewTicker(subscribeInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case changes <- last:
+			case <-ctx.Done():
+				return
+			}
+			for {
+				select {
+				case <-tick.C:
+				case <-ctx.Done():
+					return
+				}
+				next, err := s.stateChange()
+				if err == nil && next != last {
+					last = next
+					break
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// WatchRestarts calls onLimit each time systemd has restarted the unit limit
+// times within window, as for alerting on a crash loop, until ctx is done.
+// onLimit may stop the unit to end the loop before StartLimitBurst= does.
+// Restarts are counted from the NRestarts property, polled every
+// subscribeInterval; it needs systemd 235 or later.
+func (s *systemd) WatchRestarts(ctx context.Context, limit int, window time.Duration, onLimit func(restarts int)) error {
+	if limit <= 0 {
+		return fmt.Errorf("Invalid restart limit %d", limit)
+	}
+	n, err := s.restarts()
+	if err != nil {
+		return err
+	}
+	r := &restartTracker{limit: limit, window: window, last: n}
+	tick := time.NewTicker(subscribeInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return nil
+		}
+		if n, err = s.restarts(); err != nil {
+			continue
+		}
+		if count := r.observe(n, time.Now()); count != 0 {
+			onLimit(count)
+		}
+	}
+}
+
+// restarts returns the number of times systemd restarted the unit.
+func (s *systemd) restarts() (uint64, error) {
+	props, err := s.show("NRestarts")
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(props["NRestarts"], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid NRestarts %q: %v", props["NRestarts"], err)
+	}
+	return n, nil
+}
+
+// restartTracker counts the restarts of a unit within a sliding window.
+type restartTracker struct {
+	limit  int
+	window time.Duration
+	last   uint64
+	times  []time.Time
+}
+
+// observe records the restart count n seen at now. It returns the number of
+// restarts within the window once it reaches the limit, after which counting
+// starts over, and zero otherwise.
+func (r *restartTracker) observe(n uint64, now time.Time) int {
+	if n < r.last {
+		// The count was reset, such as by systemctl reset-failed.
+		r.last = n
+	}
+	for ; r.last < n; r.last++ {
+		r.times = append(r.times, now)
+	}
+	for len(r.times) != 0 && now.Sub(r.times[0]) > r.window {
+		r.times = r.times[1:]
+	}
+	if len(r.times) < r.limit {
+		return 0
+	}
+	count := len(r.times)
+	r.times = nil
+	return count
+}
+
+func (s *systemd) stateChange() (StateChange, error) {
+	st, err := s.unitState()
+	if err != nil {
+		return StateChange{}, err
+	}
+	return StateChange{
+		Status:      unitStatus(st),
+		ActiveState: st.ActiveState,
+		SubState:    st.SubState,
+	}, nil
+}
+
+// UnitFileState returns the enablement state of the unit file as reported by
+// systemd, such as "enabled", "disabled", "static" or "masked".
+// Use ParseUnitFileState to map it to a UnitFileState.
+func (s *systemd) UnitFileState() (string, error) {
+	out, err := runCommandWithOutput(s.systemctl("is-enabled", s.Name+".service"))
+	// is-enabled exits non-zero for every state other than enabled,
+	// so only fail if no state was printed.
+	if len(out) == 0 {
+		if err == nil {
+			err = fmt.Errorf("No unit file state reported for %s", s.Name)
+		}
+		return "", err
+	}
+	return out, nil
+}
+
+// IsEnabled reports whether systemctl is-enabled considers the unit enabled,
+// along with the unit file state that tells, for instance, a static unit that
+// cannot be disabled from a disabled one.
+func (s *systemd) IsEnabled() (bool, UnitFileState, error) {
+	state, err := s.UnitFileState()
+	if err != nil {
+		return false, UnitFileUnknown, err
+	}
+	st := ParseUnitFileState(state)
+	return st.Enabled(), st, nil
+}
+
+const systemdSocketScript = `[Unit]
+Description=Socket of {{.Name}}
+
+[Socket]
+ListenStream={{.ListenStream}}
+{{if .FileDescriptorName}}FileDescriptorName={{.FileDescriptorName}}{{end}}
+Service={{.Name}}.service
 
 [Install]
-WantedBy=multi-user.target
+WantedBy=sockets.target
 `
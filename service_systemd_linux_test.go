@@ -0,0 +1,667 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseUnitState(t *testing.T) {
+	tests := []struct {
+		out   string
+		want  unitState
+		valid bool
+	}{
+		{
+			"LoadState=loaded\nActiveState=active\nSubState=running\nMainPID=42\nType=simple\nRemainAfterExit=no",
+			unitState{"loaded", "active", "running", 42, "simple", false}, true,
+		},
+		{
+			// Property order follows systemd, not the request.
+			"MainPID=0\nSubState=dead\nActiveState=inactive\nLoadState=not-found",
+			unitState{"not-found", "inactive", "dead", 0, "", false}, true,
+		},
+		{
+			"LoadState=loaded\nActiveState=failed\nSubState=failed\nMainPID=0\n",
+			unitState{"loaded", "failed", "failed", 0, "", false}, true,
+		},
+		{
+			"LoadState=loaded\nActiveState=active\nSubState=exited\nMainPID=0\nType=oneshot\nRemainAfterExit=yes",
+			unitState{"loaded", "active", "exited", 0, "oneshot", true}, true,
+		},
+		{"", unitState{}, false},
+		{"LoadState=loaded\nActiveState=active\nMainPID=x", unitState{}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseUnitState(tt.out)
+		if !tt.valid {
+			if err == nil {
+				t.Errorf("parseUnitState(%q) want error, got nil", tt.out)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseUnitState(%q) unexpected error: %v", tt.out, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseUnitState(%q) = %+v, want %+v", tt.out, got, tt.want)
+		}
+	}
+}
+
+func TestParseUnitStates(t *testing.T) {
+	out := "LoadState=loaded\nActiveState=active\nSubState=running\nMainPID=42\n\n" +
+		"LoadState=not-found\nActiveState=inactive\nSubState=dead\nMainPID=0"
+	states, err := parseUnitStates(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 || states[0].MainPID != 42 || states[1].LoadState != "not-found" {
+		t.Errorf("parseUnitStates = %+v", states)
+	}
+	if _, err = parseUnitStates(out + "\n\nbogus"); err == nil {
+		t.Error("parseUnitStates accepted a block without states")
+	}
+}
+
+func TestUnitStatus(t *testing.T) {
+	tests := []struct {
+		active, sub, typ string
+		remain           bool
+		want             Status
+	}{
+		{"active", "running", "simple", false, StatusRunning},
+		{"active", "exited", "simple", false, StatusStopped},
+		{"active", "exited", "simple", true, StatusRunning},
+		{"active", "exited", "forking", false, StatusStopped},
+		{"active", "exited", "oneshot", false, StatusStopped},
+		{"active", "exited", "oneshot", true, StatusRunning},
+		{"activating", "start", "oneshot", false, StatusRunning},
+		{"activating", "start", "oneshot", true, StatusRunning},
+		{"inactive", "dead", "oneshot", false, StatusStopped},
+		{"inactive", "dead", "oneshot", true, StatusStopped},
+		{"failed", "failed", "oneshot", true, StatusFailed},
+		{"failed", "failed", "simple", false, StatusFailed},
+		{"bogus", "dead", "simple", false, StatusUnknown},
+	}
+	for _, tt := range tests {
+		st := unitState{"loaded", tt.active, tt.sub, 0, tt.typ, tt.remain}
+		if got := unitStatus(st); got != tt.want {
+			t.Errorf("unitStatus(%s/%s, Type=%s, RemainAfterExit=%v) = %v, want %v",
+				tt.active, tt.sub, tt.typ, tt.remain, got, tt.want)
+		}
+	}
+}
+
+func TestRestartError(t *testing.T) {
+	tests := []struct {
+		active, sub string
+		done        bool
+		fail        bool
+	}{
+		{"active", "running", false, false},
+		{"active", "running", true, false},
+		{"activating", "start", false, false},
+		{"activating", "start", true, true},
+		{"activating", "auto-restart", false, true},
+		{"failed", "failed", false, true},
+		{"active", "exited", true, true},
+	}
+	for _, tt := range tests {
+		st := unitState{"loaded", tt.active, tt.sub, 0, "simple", false}
+		if err := restartError(st, tt.done); (err != nil) != tt.fail {
+			t.Errorf("restartError(%s/%s, %v) = %v, want failure %v", tt.active, tt.sub, tt.done, err, tt.fail)
+		}
+	}
+}
+
+func TestReloadDone(t *testing.T) {
+	tests := []struct {
+		active, sub string
+		done, fail  bool
+	}{
+		{"active", "running", true, false},
+		{"reloading", "reload", false, false},
+		{"activating", "auto-restart", true, true},
+		{"failed", "failed", true, true},
+	}
+	for _, tt := range tests {
+		done, err := reloadDone(unitState{"loaded", tt.active, tt.sub, 0, "notify", false})
+		if done != tt.done || (err != nil) != tt.fail {
+			t.Errorf("reloadDone(%s/%s) = %v, %v, want %v, failure %v", tt.active, tt.sub, done, err, tt.done, tt.fail)
+		}
+	}
+}
+
+func TestUnitFileStateEnabled(t *testing.T) {
+	tests := []struct {
+		state string
+		want  bool
+	}{
+		{"enabled", true},
+		{"enabled-runtime", true},
+		{"static", true},
+		{"indirect", true},
+		{"generated", true},
+		{"disabled", false},
+		{"masked", false},
+		{"linked", false},
+		{"bogus", false},
+	}
+	for _, tt := range tests {
+		if got := ParseUnitFileState(tt.state).Enabled(); got != tt.want {
+			t.Errorf("%s Enabled = %v, want %v", tt.state, got, tt.want)
+		}
+	}
+}
+
+func TestRestartTracker(t *testing.T) {
+	start := time.Now()
+	r := &restartTracker{limit: 3, window: time.Minute, last: 5}
+	steps := []struct {
+		n     uint64
+		after time.Duration
+		want  int
+	}{
+		{5, 0, 0},
+		{7, time.Second, 0},
+		{7, 2 * time.Minute, 0}, // The two restarts left the window.
+		{9, 2*time.Minute + time.Second, 0},
+		{10, 2*time.Minute + 2*time.Second, 3},
+		{11, 2*time.Minute + 3*time.Second, 0}, // Counting started over.
+		{1, 2*time.Minute + 4*time.Second, 0},  // reset-failed.
+		{3, 2*time.Minute + 5*time.Second, 3},
+	}
+	for i, step := range steps {
+		if got := r.observe(step.n, start.Add(step.after)); got != step.want {
+			t.Errorf("%d: observe(%d) = %d, want %d", i, step.n, got, step.want)
+		}
+	}
+}
+
+func TestListenFDNames(t *testing.T) {
+	tests := []struct {
+		pid, fds, names string
+		want            []string
+		valid           bool
+	}{
+		{"", "", "", nil, true},
+		{"7", "2", "http:metrics", nil, true},
+		{"42", "2", "http:metrics", []string{"http", "metrics"}, true},
+		{"42", "2", "", []string{"0", "1"}, true},
+		{"42", "x", "", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := listenFDNames(tt.pid, tt.fds, tt.names, 42)
+		if (err == nil) != tt.valid || strings.Join(got, ":") != strings.Join(tt.want, ":") || len(got) != len(tt.want) {
+			t.Errorf("listenFDNames(%q, %q, %q) = %q, %v, want %q", tt.pid, tt.fds, tt.names, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseAccounting(t *testing.T) {
+	tests := []struct {
+		v    string
+		want uint64
+	}{
+		{"1048576", 1048576},
+		{"0", 0},
+		{"18446744073709551615", 0},
+		{"[not set]", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := parseAccounting(tt.v); got != tt.want {
+			t.Errorf("parseAccounting(%q) = %d, want %d", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestInstallUnitDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &systemd{Config: &Config{
+		Name:       "go_service_test",
+		Executable: "/bin/true",
+		Arguments:  []string{"-v"},
+		Option:     KeyValue{optionUnitDir: dir},
+	}}
+	if err = s.Install(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "go_service_test.service"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "\nExecStart=/bin/true \"-v\"\n") {
+		t.Errorf("unit file lacks ExecStart:\n%s", b)
+	}
+	if err = s.Install(); err != ErrAlreadyInstalled {
+		t.Errorf("second Install = %v, want ErrAlreadyInstalled", err)
+	}
+	if err = s.Uninstall(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "go_service_test.service")); !os.IsNotExist(err) {
+		t.Errorf("unit file left after Uninstall: %v", err)
+	}
+}
+
+func TestParseExecPaths(t *testing.T) {
+	out := "LoadState=loaded\n" +
+		"ExecStart={ path=/usr/bin/app ; argv[]=/usr/bin/app -v ; ignore_errors=no ; start_time=[n/a] ; stop_time=[n/a] ; pid=0 ; code=(null) ; status=0/0 }\n" +
+		"ExecStart={ path=/opt/my app/setup ; argv[]=/opt/my app/setup ; ignore_errors=no ; start_time=[n/a] ; stop_time=[n/a] ; pid=0 ; code=(null) ; status=0/0 }"
+	got := parseExecPaths(out)
+	want := []string{"/usr/bin/app", "/opt/my app/setup"}
+	if len(got) != len(want) {
+		t.Fatalf("parseExecPaths = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("parseExecPaths[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+	if got := parseExecPaths("LoadState=not-found\nExecStart="); len(got) != 0 {
+		t.Errorf("parseExecPaths without commands = %q", got)
+	}
+}
+
+func TestInstallSockets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &systemd{Config: &Config{
+		Name:       "go_service_test",
+		Executable: "/bin/true",
+		Sockets: []SocketConfig{
+			{ListenStream: ":8080", FileDescriptorName: "http"},
+			{ListenStream: "/run/go_service_test.sock"},
+		},
+		Option: KeyValue{optionUnitDir: dir},
+	}}
+	if err = s.Install(); err != nil {
+		t.Fatal(err)
+	}
+	for unit, lines := range map[string][]string{
+		"go_service_test.socket":   {"\nListenStream=:8080\n", "\nFileDescriptorName=http\n", "\nService=go_service_test.service\n"},
+		"go_service_test-1.socket": {"\nListenStream=/run/go_service_test.sock\n", "\nService=go_service_test.service\n"},
+	} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, unit))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range lines {
+			if !strings.Contains(string(b), line) {
+				t.Errorf("%s lacks %q:\n%s", unit, line, b)
+			}
+		}
+	}
+	if err = s.Uninstall(); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("%d files left after Uninstall", len(files))
+	}
+}
+
+func TestInstallTargetRoot(t *testing.T) {
+	root, err := ioutil.TempDir("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	s := &systemd{Config: &Config{
+		Name:       "go_service_test",
+		Executable: "/bin/true",
+		Option:     KeyValue{optionTargetRoot: root, optionAutoEnable: false},
+	}}
+	if err = s.Install(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(root, "etc/systemd/system/go_service_test.service")); err != nil {
+		t.Error(err)
+	}
+	if args := s.rootArgs("enable", "go_service_test.service"); args[0] != "--root="+root {
+		t.Errorf("rootArgs = %q, want --root first", args)
+	}
+
+	s.Option[optionUserService] = true
+	if _, err = s.configPath(); err == nil {
+		t.Error("configPath succeeded for a user service with TargetRoot")
+	}
+}
+
+func TestInstallEnableWarning(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	root, err := ioutil.TempDir("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// A systemctl that warns on stderr, failing only when asked to disable.
+	bin := filepath.Join(root, "bin")
+	if err = os.Mkdir(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\necho 'Created symlink, overlapping alias.' >&2\ncase \"$*\" in *disable*) exit 1;; esac\n"
+	if err = ioutil.WriteFile(filepath.Join(bin, "systemctl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	s := &systemd{Config: &Config{
+		Name:       "go_service_test",
+		Executable: "/bin/true",
+		Option:     KeyValue{optionTargetRoot: root},
+	}}
+	if err = s.Install(); err != nil {
+		t.Fatalf("Install = %v, want success despite warnings", err)
+	}
+	err = s.Uninstall()
+	if err == nil || !strings.Contains(err.Error(), "overlapping alias") {
+		t.Errorf("Uninstall = %v, want the stderr of the failed disable", err)
+	}
+}
+
+func TestUninstallKeepFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &systemd{Config: &Config{
+		Name:       "go_service_test",
+		Executable: "/bin/true",
+		Option:     KeyValue{optionUnitDir: dir, optionKeepFile: true},
+	}}
+	if err = s.Install(); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Uninstall(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "go_service_test.service")); err != nil {
+		t.Errorf("unit file removed despite KeepFile: %v", err)
+	}
+}
+
+func TestUninstallStops(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	dir, err := ioutil.TempDir("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A systemctl reporting the unit running, that records its commands.
+	calls := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"$1\" >> " + calls + "\n" +
+		"case \"$1\" in show) printf 'LoadState=loaded\\nActiveState=active\\nSubState=running\\n';; stop) exit 1;; esac\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, "systemctl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	s := &systemd{Config: &Config{
+		Name:   "go_service_test",
+		Logger: ConsoleLogger,
+		Option: KeyValue{optionKeepFile: true},
+	}}
+	if err = s.Uninstall(); err != nil {
+		t.Fatalf("Uninstall = %v, want a failed stop to be only logged", err)
+	}
+	b, err := ioutil.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Fields(string(b)); strings.Join(got, " ") != "show stop disable" {
+		t.Errorf("systemctl called with %q, want show, stop and disable", got)
+	}
+}
+
+func TestUninstallPlan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &systemd{Config: &Config{
+		Name:       "go_service_test",
+		Executable: "/bin/true",
+		Sockets:    []SocketConfig{{ListenStream: ":8080"}},
+		Option:     KeyValue{optionUnitDir: dir},
+	}}
+	if _, err = s.UninstallPlan(); err != ErrNotInstalled {
+		t.Errorf("UninstallPlan before Install = %v, want ErrNotInstalled", err)
+	}
+	if err = s.Install(); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := s.UninstallPlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Remove " + filepath.Join(dir, "go_service_test.socket") + "\n" +
+		"Remove " + filepath.Join(dir, "go_service_test.service")
+	if plan != want {
+		t.Errorf("UninstallPlan = %q, want %q", plan, want)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "go_service_test.service")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInstallCopyToPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "build", "app")
+	dest := filepath.Join(dir, "bin", "app")
+	if err = os.Mkdir(filepath.Dir(src), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(src, []byte("#!/bin/sh\n"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	s := &systemd{Config: &Config{
+		Name:       "go_service_test",
+		Executable: src,
+		Option:     KeyValue{optionUnitDir: dir, optionCopyToPath: dest},
+	}}
+	if err = s.Install(); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0750 {
+		t.Errorf("copy has mode %v, want 0750", fi.Mode().Perm())
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "go_service_test.service"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "\nExecStart="+dest+"\n") {
+		t.Errorf("unit does not run the copy:\n%s", b)
+	}
+
+	// A second Install without Force leaves the deployed copy alone.
+	if err = ioutil.WriteFile(src, []byte("#!/bin/sh\n# new build\n"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Install(); err != ErrAlreadyInstalled {
+		t.Errorf("second Install = %v, want ErrAlreadyInstalled", err)
+	}
+	if b, err = ioutil.ReadFile(dest); err != nil || string(b) != "#!/bin/sh\n" {
+		t.Errorf("copy after a failed Install = %q, %v, want the first build", b, err)
+	}
+
+	// Installing from the copy itself leaves it alone.
+	s.Executable = dest
+	s.Option[optionForce] = true
+	if err = s.Install(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInstallCopyToPathTargetRoot(t *testing.T) {
+	root, err := ioutil.TempDir("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	src := filepath.Join(root, "app")
+	if err = ioutil.WriteFile(src, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	dest := "/opt/go_service_test/bin/app"
+	s := &systemd{Config: &Config{
+		Name:       "go_service_test",
+		Executable: src,
+		Option:     KeyValue{optionTargetRoot: root, optionAutoEnable: false, optionCopyToPath: dest},
+	}}
+	if err = s.Install(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(root, dest)); err != nil {
+		t.Errorf("executable not copied below TargetRoot: %v", err)
+	}
+	if _, err = os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("executable copied to the host path %s: %v", dest, err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(root, "etc/systemd/system/go_service_test.service"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "\nExecStart="+dest+"\n") {
+		t.Errorf("unit does not run the copy by its path on the target:\n%s", b)
+	}
+}
+
+func TestParseSystemdVersion(t *testing.T) {
+	out := "systemd 245 (245.4-4ubuntu3)\n+PAM +AUDIT +SELINUX"
+	if v, err := parseSystemdVersion(out); err != nil || v != 245 {
+		t.Errorf("parseSystemdVersion = %d, %v, want 245", v, err)
+	}
+	if _, err := parseSystemdVersion("bash: systemctl: not found"); err == nil {
+		t.Error("parseSystemdVersion of unexpected output succeeded")
+	}
+}
+
+// warningLogger records the warnings logged to it.
+type warningLogger struct {
+	consoleLogger
+	warnings []string
+}
+
+func (l *warningLogger) Warningf(format string, a ...interface{}) error {
+	l.warnings = append(l.warnings, fmt.Sprintf(format, a...))
+	return nil
+}
+
+func TestInstallExecFallback(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	dir, err := ioutil.TempDir("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A systemctl whose version is set by the test.
+	version := filepath.Join(dir, "version")
+	script := "#!/bin/sh\n[ \"$1\" = --version ] && echo \"systemd $(cat " + version + ") (stub)\"\nexit 0\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, "systemctl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tests := []struct {
+		version string
+		typ     string
+		warned  bool
+	}{
+		{"239", "simple", true},
+		{"240", "exec", false},
+	}
+	for _, tt := range tests {
+		if err = ioutil.WriteFile(version, []byte(tt.version), 0644); err != nil {
+			t.Fatal(err)
+		}
+		l := &warningLogger{consoleLogger: ConsoleLogger}
+		s := &systemd{Config: &Config{
+			Name:       "go_service_test",
+			Executable: "/bin/true",
+			Logger:     l,
+			Option:     KeyValue{optionUnitDir: dir, optionServiceType: "exec", optionForce: true},
+		}}
+		if err = s.Install(); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, "go_service_test.service"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), "\nType="+tt.typ+"\n") {
+			t.Errorf("systemd %s: unit lacks Type=%s:\n%s", tt.version, tt.typ, b)
+		}
+		if warned := len(l.warnings) == 1 && strings.Contains(l.warnings[0], "does not support Type=exec"); warned != tt.warned {
+			t.Errorf("systemd %s: warnings %q, want a Type=exec warning %v", tt.version, l.warnings, tt.warned)
+		}
+	}
+}
+
+func TestInstallInvalidEnvName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &systemd{Config: &Config{
+		Name:       "go_service_test",
+		Executable: "/bin/true",
+		EnvVars:    map[string]string{"X;id>/tmp/p;Y": "1"},
+		Option:     KeyValue{optionUnitDir: dir},
+	}}
+	if err = s.Install(); err == nil {
+		t.Fatal("Install with a shell command as an EnvVars name succeeded")
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("%d files written by a failed Install", len(files))
+	}
+}
@@ -5,15 +5,28 @@
 package service
 
 import (
-	"errors"
+	"bytes"
+	"context"
 	"fmt"
 	"os"
+	"os/exec"
 	"os/signal"
+	"strings"
 	"syscall"
 	"text/template"
 	"time"
 )
 
+func isSystemV(context.Context) bool {
+	if _, err := exec.LookPath("service"); err != nil {
+		return false
+	}
+	if fi, err := os.Stat("/etc/init.d"); err == nil && fi.IsDir() {
+		return true
+	}
+	return false
+}
+
 type sysv struct {
 	i Interface
 	*Config
@@ -35,7 +48,7 @@ func (s *sysv) String() string {
 	return s.Name
 }
 
-var errNoUserServiceSystemV = errors.New("User services are not supported on SystemV.")
+var errNoUserServiceSystemV error = userServiceError("SystemV")
 
 func (s *sysv) configPath() (cp string, err error) {
 	if s.Option.bool(optionUserService, optionUserServiceDefault) {
@@ -49,43 +62,53 @@ func (s *sysv) template() *template.Template {
 	return template.Must(template.New("").Funcs(tf).Parse(sysvScript))
 }
 
+func (s *sysv) ConfigPath() (string, error) {
+	return s.configPath()
+}
+
 func (s *sysv) Install() error {
 	confPath, err := s.configPath()
 	if err != nil {
 		return err
 	}
-	_, err = os.Stat(confPath)
-	if err == nil {
-		return fmt.Errorf("Init already exists: %s", confPath)
+	if err = s.Validate(); err != nil {
+		return err
+	}
+	for _, dep := range s.Dependencies {
+		if len(dep) == 0 || strings.ContainsAny(dep, " \t\r\n") {
+			return fmt.Errorf("Invalid dependency %q", dep)
+		}
 	}
-
-	f, err := os.Create(confPath)
+	path, err := s.installExecPath(confPath)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-
-	path, err := s.execPath()
+	script, err := s.script(path)
 	if err != nil {
 		return err
 	}
 
-	var to = &struct {
-		*Config
-		Path string
-	}{
-		s.Config,
-		path,
-	}
-
-	err = s.template().Execute(f, to)
+	f, err := createConfig(confPath, 0755, s.Option.bool(optionForce, optionForceDefault))
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	if err = os.Chmod(confPath, 0755); err != nil {
+	if _, err = f.Write(script); err != nil {
 		return err
 	}
+	if err = restoreCon(s.Option, confPath); err != nil {
+		return err
+	}
+
+	// Let the distribution order the links by the dependencies in the LSB
+	// header where it can.
+	if _, err = exec.LookPath("update-rc.d"); err == nil {
+		return run("update-rc.d", s.Name, "defaults")
+	}
+	if _, err = exec.LookPath("insserv"); err == nil {
+		return run("insserv", s.Name)
+	}
 	for _, i := range [...]string{"2", "3", "4", "5"} {
 		if err = os.Symlink(confPath, "/etc/rc"+i+".d/S50"+s.Name); err != nil {
 			continue
@@ -100,18 +123,66 @@ func (s *sysv) Install() error {
 	return nil
 }
 
+// script renders the init script that runs the executable at path.
+func (s *sysv) script(path string) ([]byte, error) {
+	env, err := s.expandEnvVars(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var to = &struct {
+		*Config
+		Path      string
+		EnvVars   map[string]string
+		PIDFile   string
+		Respawn   bool
+		OnFailure bool
+	}{
+		Config:    s.Config,
+		Path:      path,
+		EnvVars:   env,
+		PIDFile:   s.Option.string(optionPIDFile, ""),
+		Respawn:   s.Config.Restart == RestartOnFailure || s.Config.Restart == RestartAlways,
+		OnFailure: s.Config.Restart == RestartOnFailure,
+	}
+
+	var b bytes.Buffer
+	if err = s.template().Execute(&b, to); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
 func (s *sysv) Uninstall() error {
 	cp, err := s.configPath()
 	if err != nil {
 		return err
 	}
-	if err := os.Remove(cp); err != nil {
-		return err
+	if _, err = exec.LookPath("update-rc.d"); err == nil {
+		err = run("update-rc.d", "-f", s.Name, "remove")
+	} else if _, err = exec.LookPath("insserv"); err == nil {
+		err = run("insserv", "-r", s.Name)
+	} else {
+		err = nil
+		for _, i := range [...]string{"2", "3", "4", "5"} {
+			os.Remove("/etc/rc" + i + ".d/S50" + s.Name)
+		}
+		for _, i := range [...]string{"0", "1", "6"} {
+			os.Remove("/etc/rc" + i + ".d/K02" + s.Name)
+		}
 	}
-	return nil
+	// Remove the script even if the links could not be, so that a failed
+	// update-rc.d or insserv does not leave a half removed service behind.
+	if rerr := os.Remove(cp); rerr != nil && err == nil {
+		err = rerr
+	}
+	return err
 }
 
 func (s *sysv) Logger(errs chan<- error) (Logger, error) {
+	if s.Config.Logger != nil {
+		return s.Config.Logger, nil
+	}
 	if system.Interactive() {
 		return ConsoleLogger, nil
 	}
@@ -127,15 +198,21 @@ func (s *sysv) Run() (err error) {
 		return err
 	}
 
+	stopReload := handleReload(s.i, s, s.Config)
 	s.Option.funcSingle(optionRunWait, func() {
 		var sigChan = make(chan os.Signal, 3)
 		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
 		<-sigChan
 	})()
+	stopReload()
 
 	return s.i.Stop(s)
 }
 
+func (s *sysv) RunForeground() error {
+	return runForeground(s.i, s, s.Config)
+}
+
 func (s *sysv) Start() error {
 	return run("service", s.Name, "start")
 }
@@ -153,26 +230,50 @@ func (s *sysv) Restart() error {
 	return s.Start()
 }
 
+func (s *sysv) Status() (Status, error) {
+	return s.checkHealth(s.status())
+}
+
+func (s *sysv) status() (Status, error) {
+	cp, err := s.configPath()
+	if err != nil {
+		return StatusUnknown, err
+	}
+	if _, err = os.Stat(cp); err != nil {
+		return StatusUnknown, ErrNotInstalled
+	}
+	out, err := runWithOutput(cp, "status")
+	switch {
+	case err == nil:
+		return StatusRunning, nil
+	case out == "Stopped":
+		return StatusStopped, nil
+	}
+	return StatusUnknown, err
+}
+
 const sysvScript = `#!/bin/sh
 # For RedHat and cousins:
 # chkconfig: - 99 01
-# description: {{.Description}}
+# description: {{.Description|oneLine}}
 # processname: {{.Path}}
 
 ### BEGIN INIT INFO
-# Provides:          {{.Path}}
-# Required-Start:
-# Required-Stop:
+# Provides:          {{.Name}}
+# Required-Start:{{if .Dependencies}}    {{range $i, $dep := .Dependencies}}{{if $i}} {{end}}{{$dep}}{{end}}{{end}}
+# Required-Stop:{{if .Dependencies}}     {{range $i, $dep := .Dependencies}}{{if $i}} {{end}}{{$dep}}{{end}}{{end}}
 # Default-Start:     2 3 4 5
 # Default-Stop:      0 1 6
-# Short-Description: {{.DisplayName}}
-# Description:       {{.Description}}
+# Short-Description: {{.DisplayName|oneLine}}
+# Description:       {{.Description|oneLine}}
 ### END INIT INFO
 
+{{range $k, $v := .EnvVars}}export {{$k}}={{$v|shellQuote}}
+{{end}}
 cmd="{{.Path}}{{range .Arguments}} {{.|cmd}}{{end}}"
 
 name=$(basename $(readlink -f $0))
-pid_file="/var/run/$name.pid"
+pid_file={{if .PIDFile}}{{.PIDFile|shellQuote}}{{else}}"/var/run/$name.pid"{{end}}
 stdout_log="/var/log/$name.log"
 stderr_log="/var/log/$name.err"
 
@@ -185,7 +286,19 @@ get_pid() {
 is_running() {
     [ -f "$pid_file" ] && ps $(get_pid) > /dev/null 2>&1
 }
-
+{{if .Respawn}}
+# Keeps restarting the program until it is stopped{{if .OnFailure}} or exits cleanly{{end}}.
+respawn() {
+    trap 'kill $child 2> /dev/null; exit 0' TERM INT
+    while :; do
+        $cmd &
+        child=$!
+        wait $child
+        {{if .OnFailure}}[ $? -eq 0 ] && break{{end}}
+        sleep 1
+    done
+}
+{{end}}
 case "$1" in
     start)
         if is_running; then
@@ -193,8 +306,12 @@ case "$1" in
         else
             echo "Starting $name"
             {{if .WorkingDirectory}}cd '{{.WorkingDirectory}}'{{end}}
-            $cmd >> "$stdout_log" 2>> "$stderr_log" &
-            echo $! > "$pid_file"
+            {{if .Respawn}}respawn{{else}}$cmd{{end}} >> "$stdout_log" 2>> "$stderr_log" &
+            {{if .PIDFile}}# The program writes its own PID to $pid_file.
+            for i in $(seq 1 10); do
+                is_running && break
+                sleep 1
+            done{{else}}echo $! > "$pid_file"{{end}}
             if ! is_running; then
                 echo "Unable to start, see $stdout_log and $stderr_log"
                 exit 1
@@ -0,0 +1,90 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSysvScriptHeader(t *testing.T) {
+	s := &sysv{Config: &Config{Name: "go_service_test"}}
+	b, err := s.script("/usr/bin/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := string(b)
+	for _, line := range []string{
+		"\n# Provides:          go_service_test\n",
+		"\n# Required-Start:\n",
+		"\n# Required-Stop:\n",
+	} {
+		if !strings.Contains(script, line) {
+			t.Errorf("script lacks %q:\n%s", line, script)
+		}
+	}
+
+	s.Dependencies = []string{"$network", "$syslog"}
+	if b, err = s.script("/usr/bin/app"); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"\n# Required-Start:    $network $syslog\n",
+		"\n# Required-Stop:     $network $syslog\n",
+	} {
+		if !strings.Contains(string(b), line) {
+			t.Errorf("script lacks %q:\n%s", line, b)
+		}
+	}
+}
+
+func TestSysvScriptPIDFile(t *testing.T) {
+	s := &sysv{Config: &Config{Name: "go_service_test"}}
+	b, err := s.script("/usr/bin/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `echo $! > "$pid_file"`) {
+		t.Errorf("script does not record the started process:\n%s", b)
+	}
+
+	s.Option = KeyValue{optionPIDFile: "/run/app.pid"}
+	if b, err = s.script("/usr/bin/app"); err != nil {
+		t.Fatal(err)
+	}
+	script := string(b)
+	if !strings.Contains(script, "\npid_file='/run/app.pid'\n") {
+		t.Errorf("script does not use PIDFile:\n%s", script)
+	}
+	if strings.Contains(script, "echo $!") {
+		t.Errorf("script overwrites the PID file the program writes:\n%s", script)
+	}
+}
+
+func TestSysvScriptRestart(t *testing.T) {
+	tests := []struct {
+		restart          RestartPolicy
+		respawn, onlyErr bool
+	}{
+		{RestartDefault, false, false},
+		{RestartAlways, true, false},
+		{RestartOnFailure, true, true},
+		{RestartNever, false, false},
+	}
+	for _, tt := range tests {
+		s := &sysv{Config: &Config{Name: "go_service_test", Restart: tt.restart}}
+		b, err := s.script("/usr/bin/app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		script := string(b)
+		if got := strings.Contains(script, "\n            respawn >> "); got != tt.respawn {
+			t.Errorf("Restart %v: script respawns = %v, want %v:\n%s", tt.restart, got, tt.respawn, script)
+		}
+		if got := strings.Contains(script, "[ $? -eq 0 ] && break"); got != tt.onlyErr {
+			t.Errorf("Restart %v: script stops on a clean exit = %v, want %v:\n%s", tt.restart, got, tt.onlyErr, script)
+		}
+	}
+}
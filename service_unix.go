@@ -7,12 +7,72 @@
 package service
 
 import (
+	"bytes"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log/syslog"
+	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 )
 
+// reloadSignalValues maps the names in reloadSignals to their signal.
+var reloadSignalValues = map[string]syscall.Signal{
+	"HUP": syscall.SIGHUP, "INT": syscall.SIGINT, "QUIT": syscall.SIGQUIT,
+	"USR1": syscall.SIGUSR1, "USR2": syscall.SIGUSR2, "ALRM": syscall.SIGALRM,
+	"TERM": syscall.SIGTERM, "CONT": syscall.SIGCONT, "WINCH": syscall.SIGWINCH,
+}
+
+// handleReload catches the ReloadSignal option, if set, and calls reload each
+// time it is received. The returned func stops the handler.
+func handleReload(i Interface, s Service, c *Config) func() {
+	name, _ := reloadSignal(c.Option)
+	if len(name) == 0 {
+		return func() {}
+	}
+	var sigChan = make(chan os.Signal, 1)
+	signal.Notify(sigChan, reloadSignalValues[name])
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sigChan:
+				reload(i, s, c)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigChan)
+		close(done)
+	}
+}
+
+// reload reopens Config.Logger if it is a Reopener, so logging survives log
+// rotation, and then calls Reload on i if it is a Reloader. Errors are sent to
+// the service logger.
+func reload(i Interface, s Service, c *Config) {
+	logError := func(err error) {
+		if err == nil {
+			return
+		}
+		if l, lerr := s.Logger(nil); lerr == nil {
+			l.Error(err)
+		}
+	}
+	if r, ok := c.Logger.(Reopener); ok {
+		logError(r.Reopen())
+	}
+	if r, ok := i.(Reloader); ok {
+		logError(r.Reload(s))
+	}
+}
+
 func newSysLogger(name string, errs chan<- error) (Logger, error) {
 	w, err := syslog.New(syslog.LOG_INFO, name)
 	if err != nil {
@@ -33,6 +93,12 @@ func (s sysLogger) send(err error) error {
 	return err
 }
 
+// Reopen closes the connection to the system logger. The next message
+// connects again, to the log socket as it is then.
+func (s sysLogger) Reopen() error {
+	return s.Writer.Close()
+}
+
 func (s sysLogger) Error(v ...interface{}) error {
 	return s.send(s.Writer.Err(fmt.Sprint(v...)))
 }
@@ -52,8 +118,127 @@ func (s sysLogger) Infof(format string, a ...interface{}) error {
 	return s.send(s.Writer.Info(fmt.Sprintf(format, a...)))
 }
 
+// createConfig creates the file at path for writing with the given
+// permissions, regardless of the process umask. It fails with
+// ErrAlreadyInstalled if the file exists, unless force is set, in which case
+// the file is truncated.
+func createConfig(path string, perm os.FileMode, force bool) (*os.File, error) {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flag, perm)
+	if os.IsExist(err) {
+		return nil, ErrAlreadyInstalled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = f.Chmod(perm); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// installExecPath returns the executable Install points the service at. With
+// the CopyToPath option the executable is first copied there, below the
+// TargetRoot option if set, unless it already is that file. The copy is not
+// made if the configuration at confPath exists and the Force option is unset,
+// as Install then fails with ErrAlreadyInstalled.
+func (c *Config) installExecPath(confPath string) (string, error) {
+	path, err := c.execPath()
+	if err != nil {
+		return "", err
+	}
+	dest := c.Option.string(optionCopyToPath, "")
+	if len(dest) == 0 {
+		return path, nil
+	}
+	if dest, err = filepath.Abs(dest); err != nil {
+		return "", err
+	}
+	if !c.Option.bool(optionForce, optionForceDefault) {
+		if _, err = os.Lstat(confPath); err == nil {
+			return "", ErrAlreadyInstalled
+		}
+	}
+	src, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	copyPath := filepath.Join(c.Option.string(optionTargetRoot, ""), dest)
+	if fi, err := os.Stat(copyPath); err == nil && os.SameFile(src, fi) {
+		return dest, nil
+	}
+	if err = copyExecutable(copyPath, path, src.Mode()); err != nil {
+		return "", fmt.Errorf("Failed to copy %s to %s: %v", path, copyPath, err)
+	}
+	return dest, nil
+}
+
+// copyExecutable copies the file at src to dest with mode. The copy is
+// renamed into place, so a running executable at dest is replaced rather than
+// overwritten.
+func copyExecutable(dest, src string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	tmp := dest + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp, dest)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
 func run(command string, arguments ...string) error {
-	cmd := exec.Command(command, arguments...)
+	return runCommand(exec.Command(command, arguments...))
+}
+
+// lockedWriter serializes the writes of a command's stdout and stderr.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// runCommand runs a prepared command the same way run does. Whether it failed
+// is decided by its exit status alone, as systemctl and others print warnings
+// on success; stderr is only added to the error of a failed command.
+func runCommand(cmd *exec.Cmd) error {
+	command := cmd.Args[0]
+
+	output := CommandOutput
+	if output != nil {
+		output = &lockedWriter{w: output}
+		if cmd.Stdout == nil {
+			cmd.Stdout = output
+		}
+	}
 
 	// Connect pipe to read Stderr
 	stderr, err := cmd.StderrPipe()
@@ -69,20 +254,44 @@ func run(command string, arguments ...string) error {
 		return fmt.Errorf("%q failed: %v", command, err)
 	}
 
+	var slurp bytes.Buffer
+	w := io.Writer(&slurp)
+	if output != nil {
+		w = io.MultiWriter(&slurp, output)
+	}
+	io.Copy(w, stderr)
+
 	// Zero exit status
 	// Darwin: launchctl can fail with a zero exit status,
 	// so check for emtpy stderr
-	if command == "launchctl" {
-		slurp, _ := ioutil.ReadAll(stderr)
-		if len(slurp) > 0 {
-			return fmt.Errorf("%q failed with stderr: %s", command, slurp)
-		}
+	if command == "launchctl" && slurp.Len() > 0 {
+		cmd.Wait()
+		return fmt.Errorf("%q failed with stderr: %s", command, slurp.Bytes())
 	}
 
 	if err := cmd.Wait(); err != nil {
 		// Command didn't exit with a zero exit status.
+		if msg := bytes.TrimSpace(slurp.Bytes()); len(msg) != 0 {
+			return fmt.Errorf("%q failed: %v: %s", command, err, msg)
+		}
 		return fmt.Errorf("%q failed: %v", command, err)
 	}
 
 	return nil
 }
+
+// runWithOutput runs command and returns its trimmed standard output.
+// The output is returned even when the command exits with a non-zero status,
+// as several status queries report their answer through the exit code.
+func runWithOutput(command string, arguments ...string) (string, error) {
+	return runCommandWithOutput(exec.Command(command, arguments...))
+}
+
+// runCommandWithOutput runs a prepared command the same way runWithOutput does.
+func runCommandWithOutput(cmd *exec.Cmd) (string, error) {
+	out, err := cmd.Output()
+	if err != nil {
+		err = fmt.Errorf("%q failed: %v", cmd.Args[0], err)
+	}
+	return strings.TrimSpace(string(out)), err
+}
@@ -5,22 +5,25 @@
 package service
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"strings"
-	"text/template"
 	"time"
 )
 
-func isUpstart() bool {
+func isUpstart(ctx context.Context) bool {
+	if _, err := exec.LookPath("initctl"); err != nil {
+		return false
+	}
 	if _, err := os.Stat("/sbin/upstart-udev-bridge"); err == nil {
 		return true
 	}
 	if _, err := os.Stat("/sbin/init"); err == nil {
-		if out, err := exec.Command("/sbin/init", "--version").Output(); err == nil {
+		if out, err := exec.CommandContext(ctx, "/sbin/init", "--version").Output(); err == nil {
 			if strings.Contains(string(out), "init (upstart") {
 				return true
 			}
@@ -29,11 +32,6 @@ func isUpstart() bool {
 	return false
 }
 
-type upstart struct {
-	i Interface
-	*Config
-}
-
 func newUpstartService(i Interface, c *Config) (Service, error) {
 	s := &upstart{
 		i:      i,
@@ -53,18 +51,22 @@ func (s *upstart) String() string {
 // Upstart has some support for user services in graphical sessions.
 // Due to the mix of actual support for user services over versions, just don't bother.
 // Upstart will be replaced by systemd in most cases anyway.
-var errNoUserServiceUpstart = errors.New("User services are not supported on Upstart.")
+var errNoUserServiceUpstart error = userServiceError("Upstart")
 
 func (s *upstart) configPath() (cp string, err error) {
 	if s.Option.bool(optionUserService, optionUserServiceDefault) {
 		err = errNoUserServiceUpstart
 		return
 	}
+	if dir := s.Option.string(optionUnitDir, ""); len(dir) != 0 {
+		cp = filepath.Join(dir, s.Config.Name+".conf")
+		return
+	}
 	cp = "/etc/init/" + s.Config.Name + ".conf"
 	return
 }
-func (s *upstart) template() *template.Template {
-	return template.Must(template.New("").Funcs(tf).Parse(upstartScript))
+func (s *upstart) ConfigPath() (string, error) {
+	return s.configPath()
 }
 
 func (s *upstart) Install() error {
@@ -72,31 +74,30 @@ func (s *upstart) Install() error {
 	if err != nil {
 		return err
 	}
-	_, err = os.Stat(confPath)
-	if err == nil {
-		return fmt.Errorf("Init already exists: %s", confPath)
+	if err = s.Validate(); err != nil {
+		return err
 	}
 
-	f, err := os.Create(confPath)
+	path, err := s.installExecPath(confPath)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	path, err := s.execPath()
+	conf, err := s.conf(path)
 	if err != nil {
 		return err
 	}
 
-	var to = &struct {
-		*Config
-		Path string
-	}{
-		s.Config,
-		path,
+	f, err := createConfig(confPath, 0644, s.Option.bool(optionForce, optionForceDefault))
+	if err != nil {
+		return err
 	}
+	defer f.Close()
 
-	return s.template().Execute(f, to)
+	if _, err = f.Write(conf); err != nil {
+		return err
+	}
+	return restoreCon(s.Option, confPath)
 }
 
 func (s *upstart) Uninstall() error {
@@ -111,6 +112,9 @@ func (s *upstart) Uninstall() error {
 }
 
 func (s *upstart) Logger(errs chan<- error) (Logger, error) {
+	if s.Config.Logger != nil {
+		return s.Config.Logger, nil
+	}
 	if system.Interactive() {
 		return ConsoleLogger, nil
 	}
@@ -126,15 +130,21 @@ func (s *upstart) Run() (err error) {
 		return err
 	}
 
+	stopReload := handleReload(s.i, s, s.Config)
 	s.Option.funcSingle(optionRunWait, func() {
 		var sigChan = make(chan os.Signal, 3)
 		signal.Notify(sigChan, os.Interrupt, os.Kill)
 		<-sigChan
 	})()
+	stopReload()
 
 	return s.i.Stop(s)
 }
 
+func (s *upstart) RunForeground() error {
+	return runForeground(s.i, s, s.Config)
+}
+
 func (s *upstart) Start() error {
 	return run("initctl", "start", s.Name)
 }
@@ -152,30 +162,41 @@ func (s *upstart) Restart() error {
 	return s.Start()
 }
 
-// The upstart script should stop with an INT or the Go runtime will terminate
-// the program before the Stop handler can run.
-const upstartScript = `# {{.Description}}
+// upstartStatusTimeout bounds how long Status waits for initctl to answer.
+var upstartStatusTimeout = 10 * time.Second
 
- {{if .DisplayName}}description    "{{.DisplayName}}"{{end}}
-
-kill signal INT
-{{if .ChRoot}}chroot {{.ChRoot}}{{end}}
-{{if .WorkingDirectory}}chdir {{.WorkingDirectory}}{{end}}
-start on filesystem or runlevel [2345]
-stop on runlevel [!2345]
-
-{{if .UserName}}setuid {{.UserName}}{{end}}
-
-respawn
-respawn limit 10 5
-umask 022
-
-console none
+func (s *upstart) Status() (Status, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), upstartStatusTimeout)
+	defer cancel()
+	return s.StatusContext(ctx)
+}
 
-pre-start script
-    test -x {{.Path}} || { stop; exit 0; }
-end script
+// StatusContext is like Status but gives up querying upstart once ctx is done.
+func (s *upstart) StatusContext(ctx context.Context) (Status, error) {
+	return s.checkHealth(s.status(ctx))
+}
 
-# Start
-exec {{.Path}}{{range .Arguments}} {{.|cmd}}{{end}}
-`
+func (s *upstart) status(ctx context.Context) (Status, error) {
+	cp, err := s.configPath()
+	if err != nil {
+		return StatusUnknown, err
+	}
+	if _, err = os.Stat(cp); err != nil {
+		return StatusUnknown, ErrNotInstalled
+	}
+	// Reports "<name> <goal>/<state>", such as "name start/running, process 42".
+	out, err := runCommandWithOutput(exec.CommandContext(ctx, "initctl", "status", s.Name))
+	if ctx.Err() != nil {
+		return StatusUnknown, fmt.Errorf("Timed out querying upstart status of %s: %v", s.Name, ctx.Err())
+	}
+	switch {
+	case strings.Contains(out, " start/"):
+		return StatusRunning, nil
+	case strings.Contains(out, " stop/"):
+		return StatusStopped, nil
+	}
+	if err == nil {
+		err = fmt.Errorf("Unknown upstart status %q for %s", out, s.Name)
+	}
+	return StatusUnknown, err
+}
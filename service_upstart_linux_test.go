@@ -0,0 +1,70 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpstartInstallUnitDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "servicetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &upstart{Config: &Config{
+		Name:       "go_service_test",
+		Executable: "/bin/true",
+		Arguments:  []string{"-v"},
+		Option: KeyValue{
+			optionUnitDir:        dir,
+			optionOOMScoreAdjust: -500,
+			optionStartOn:        "net-device-up IFACE=eth0",
+			optionEmits:          []string{"app-ready"},
+		},
+	}}
+	if err = s.Install(); err != nil {
+		t.Fatal(err)
+	}
+	cp := filepath.Join(dir, "go_service_test.conf")
+	b, err := ioutil.ReadFile(cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"\noom score -500\n",
+		"\nstart on net-device-up IFACE=eth0\nstop on runlevel [!2345]\nemits app-ready\n",
+		"\nexec /bin/true \"-v\"\n",
+	} {
+		if !strings.Contains(string(b), line) {
+			t.Errorf("job file lacks %q:\n%s", line, b)
+		}
+	}
+	if err = s.Install(); err != ErrAlreadyInstalled {
+		t.Errorf("second Install = %v, want ErrAlreadyInstalled", err)
+	}
+	if err = s.Uninstall(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(cp); !os.IsNotExist(err) {
+		t.Errorf("job file still exists after Uninstall: %v", err)
+	}
+}
+
+func TestUpstartUserServiceUnsupported(t *testing.T) {
+	s := &upstart{Config: &Config{Name: "go_service_test", Option: KeyValue{optionUserService: true}}}
+	_, err := s.configPath()
+	u, ok := err.(interface {
+		Unwrap() error
+	})
+	if !ok || u.Unwrap() != ErrUserServiceUnsupported {
+		t.Errorf("configPath = %v, want an error wrapping ErrUserServiceUnsupported", err)
+	}
+}
@@ -6,12 +6,15 @@ package service
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
 
+	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/registry"
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/eventlog"
@@ -137,6 +140,35 @@ func init() {
 	}
 }
 
+// InContainer reports whether the process runs inside a container. It is
+// always false on this system.
+func InContainer() bool {
+	return false
+}
+
+// InWSL reports whether the process runs under the Windows Subsystem for
+// Linux. It is always false on this system.
+func InWSL() bool {
+	return false
+}
+
+// Listeners returns ErrNotSupported, as only systemd passes sockets to the
+// process.
+func Listeners() (map[string]net.Listener, error) {
+	return nil, ErrNotSupported
+}
+
+// StatusAll returns ErrNotSupported, as only systemd reports the status of
+// many services in one call.
+func StatusAll(names []string) (map[string]Status, error) {
+	return nil, ErrNotSupported
+}
+
+// handleReload does nothing, Windows services have no reload signal.
+func handleReload(i Interface, s Service, c *Config) func() {
+	return func() {}
+}
+
 func (ws *windowsService) String() string {
 	if len(ws.DisplayName) > 0 {
 		return ws.DisplayName
@@ -186,11 +218,22 @@ loop:
 	return false, 0
 }
 
+func (ws *windowsService) ConfigPath() (string, error) {
+	return `HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Services\` + ws.Name, nil
+}
+
 func (ws *windowsService) Install() error {
+	if err := ws.Validate(); err != nil {
+		return err
+	}
 	exepath, err := ws.execPath()
 	if err != nil {
 		return err
 	}
+	env, err := ws.expandEnvVars(exepath)
+	if err != nil {
+		return err
+	}
 
 	m, err := mgr.Connect()
 	if err != nil {
@@ -214,6 +257,16 @@ func (ws *windowsService) Install() error {
 		return err
 	}
 	defer s.Close()
+	if err = ws.setRecoveryActions(s); err != nil {
+		s.Delete()
+		return err
+	}
+	if len(env) > 0 {
+		if err = setServiceEnv(ws.Name, env); err != nil {
+			s.Delete()
+			return err
+		}
+	}
 	err = eventlog.InstallAsEventCreate(ws.Name, eventlog.Error|eventlog.Warning|eventlog.Info)
 	if err != nil {
 		s.Delete()
@@ -222,6 +275,72 @@ func (ws *windowsService) Install() error {
 	return nil
 }
 
+// setRecoveryActions configures the service control manager to restart the
+// service when it fails, as set by Config.Restart and the Recovery options.
+func (ws *windowsService) setRecoveryActions(s *mgr.Service) error {
+	actions, nonCrash, err := ws.recoveryActions()
+	if err != nil || actions == nil {
+		return err
+	}
+	resetPeriod := ws.Option.int(optionRecoveryResetPeriod, optionRecoveryResetPeriodDefault)
+	if err = s.SetRecoveryActions(actions, uint32(resetPeriod)); err != nil {
+		return err
+	}
+	if !nonCrash {
+		return nil
+	}
+	return s.SetRecoveryActionsOnNonCrashFailures(true)
+}
+
+// recoveryActions returns the recovery actions for Config.Restart and the
+// Recovery options, or none if the service is not to be restarted, and whether
+// they also apply when the service stops with an error exit code.
+func (ws *windowsService) recoveryActions() ([]mgr.RecoveryAction, bool, error) {
+	count := ws.Option.int(optionRecoveryRestartCount, 0)
+	switch ws.Config.Restart {
+	case RestartNever:
+		return nil, false, nil
+	case RestartDefault:
+		if count <= 0 {
+			return nil, false, nil
+		}
+	}
+	delay, err := time.ParseDuration(ws.Option.string(optionRecoveryRestartDelay, optionRecoveryRestartDelayDefault))
+	if err != nil {
+		return nil, false, fmt.Errorf("Invalid %s: %v", optionRecoveryRestartDelay, err)
+	}
+	// The last action is repeated for every further failure.
+	actions := make([]mgr.RecoveryAction, 0, count+1)
+	for i := 0; i < count; i++ {
+		actions = append(actions, mgr.RecoveryAction{Type: mgr.ServiceRestart, Delay: delay})
+	}
+	if count > 0 {
+		actions = append(actions, mgr.RecoveryAction{Type: mgr.NoAction})
+	} else {
+		actions = append(actions, mgr.RecoveryAction{Type: mgr.ServiceRestart, Delay: delay})
+	}
+	// Also recover when the service stops with an error exit code. A service
+	// that stops cleanly is never restarted, so RestartAlways acts as
+	// RestartOnFailure.
+	return actions, ws.Config.Restart != RestartDefault, nil
+}
+
+// setServiceEnv sets the environment the service control manager starts the
+// service with.
+func setServiceEnv(name string, env map[string]string) error {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\`+name, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+	vars := make([]string, 0, len(env))
+	for name, value := range env {
+		vars = append(vars, name+"="+value)
+	}
+	sort.Strings(vars)
+	return key.SetStringsValue("Environment", vars)
+}
+
 func (ws *windowsService) Uninstall() error {
 	m, err := mgr.Connect()
 	if err != nil {
@@ -275,6 +394,10 @@ func (ws *windowsService) Run() error {
 	return ws.i.Stop(ws)
 }
 
+func (ws *windowsService) RunForeground() error {
+	return runForeground(ws.i, ws, ws.Config)
+}
+
 func (ws *windowsService) Start() error {
 	m, err := mgr.Connect()
 	if err != nil {
@@ -306,6 +429,38 @@ func (ws *windowsService) Stop() error {
 	return ws.stopWait(s)
 }
 
+func (ws *windowsService) Status() (Status, error) {
+	return ws.checkHealth(ws.status())
+}
+
+func (ws *windowsService) status() (Status, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return StatusUnknown, err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(ws.Name)
+	if err != nil {
+		if err == windows.ERROR_SERVICE_DOES_NOT_EXIST {
+			return StatusUnknown, ErrNotInstalled
+		}
+		return StatusUnknown, err
+	}
+	defer s.Close()
+
+	status, err := s.Query()
+	if err != nil {
+		return StatusUnknown, err
+	}
+	switch status.State {
+	case svc.Stopped:
+		return StatusStopped, nil
+	default:
+		return StatusRunning, nil
+	}
+}
+
 func (ws *windowsService) Restart() error {
 	m, err := mgr.Connect()
 	if err != nil {
@@ -375,6 +530,9 @@ func getStopTimeout() time.Duration {
 }
 
 func (ws *windowsService) Logger(errs chan<- error) (Logger, error) {
+	if ws.Config.Logger != nil {
+		return ws.Config.Logger, nil
+	}
 	if interactive {
 		return ConsoleLogger, nil
 	}
@@ -5,10 +5,61 @@
 package service
 
 import (
+	"reflect"
 	"testing"
+	"time"
+
+	"golang.org/x/sys/windows/svc/mgr"
 )
 
 func TestTimeout(t *testing.T) {
 	stopSpan := getStopTimeout()
 	t.Log("Max Stop Duration", stopSpan)
 }
+
+func TestRecoveryActions(t *testing.T) {
+	restart := mgr.RecoveryAction{Type: mgr.ServiceRestart, Delay: time.Minute}
+	tests := []struct {
+		restart  RestartPolicy
+		actions  []mgr.RecoveryAction
+		nonCrash bool
+	}{
+		{RestartDefault, nil, false},
+		{RestartAlways, []mgr.RecoveryAction{restart}, true},
+		{RestartOnFailure, []mgr.RecoveryAction{restart}, true},
+		{RestartNever, nil, false},
+	}
+	for _, tt := range tests {
+		ws := &windowsService{Config: &Config{Name: "go_service_test", Restart: tt.restart}}
+		actions, nonCrash, err := ws.recoveryActions()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actions, tt.actions) || nonCrash != tt.nonCrash {
+			t.Errorf("Restart %v: recovery actions %v, %v, want %v, %v", tt.restart, actions, nonCrash, tt.actions, tt.nonCrash)
+		}
+	}
+
+	ws := &windowsService{Config: &Config{
+		Name:    "go_service_test",
+		Restart: RestartNever,
+		Option:  KeyValue{optionRecoveryRestartCount: 2},
+	}}
+	if actions, _, _ := ws.recoveryActions(); actions != nil {
+		t.Errorf("RestartNever with RecoveryRestartCount: recovery actions %v, want none", actions)
+	}
+	ws.Config.Restart = RestartDefault
+	want := []mgr.RecoveryAction{restart, restart, {Type: mgr.NoAction}}
+	if actions, nonCrash, _ := ws.recoveryActions(); !reflect.DeepEqual(actions, want) || nonCrash {
+		t.Errorf("RecoveryRestartCount 2: recovery actions %v, %v, want %v, false", actions, nonCrash, want)
+	}
+}
+
+func TestSystemdOnlyFunctions(t *testing.T) {
+	if _, err := Listeners(); err != ErrNotSupported {
+		t.Errorf("Listeners = %v, want ErrNotSupported", err)
+	}
+	if _, err := StatusAll([]string{"go_service_test"}); err != ErrNotSupported {
+		t.Errorf("StatusAll = %v, want ErrNotSupported", err)
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckHealth(t *testing.T) {
+	errProbe := errors.New("probe failed")
+	errQuery := errors.New("query failed")
+	tests := []struct {
+		probe      func() error
+		status     Status
+		err        error
+		wantStatus Status
+		wantErr    error
+	}{
+		{nil, StatusRunning, nil, StatusRunning, nil},
+		{func() error { return nil }, StatusRunning, nil, StatusRunning, nil},
+		{func() error { return errProbe }, StatusRunning, nil, StatusDegraded, errProbe},
+		{func() error { return errProbe }, StatusStopped, nil, StatusStopped, nil},
+		{func() error { return errProbe }, StatusUnknown, errQuery, StatusUnknown, errQuery},
+	}
+	for i, tt := range tests {
+		c := &Config{Name: "go_service_test", HealthCheck: tt.probe}
+		status, err := c.checkHealth(tt.status, tt.err)
+		if status != tt.wantStatus || err != tt.wantErr {
+			t.Errorf("%d: checkHealth = (%v, %v), want (%v, %v)", i, status, err, tt.wantStatus, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+// UnitFileState is the enablement state of a systemd unit file.
+type UnitFileState int
+
+// Unit file states as reported by systemd.
+const (
+	UnitFileUnknown UnitFileState = iota
+	UnitFileEnabled
+	UnitFileEnabledRuntime
+	UnitFileLinked
+	UnitFileLinkedRuntime
+	UnitFileAlias
+	UnitFileMasked
+	UnitFileMaskedRuntime
+	UnitFileStatic
+	UnitFileIndirect
+	UnitFileDisabled
+	UnitFileGenerated
+	UnitFileTransient
+	UnitFileBad
+)
+
+var unitFileStateNames = [...]string{
+	UnitFileUnknown:        "unknown",
+	UnitFileEnabled:        "enabled",
+	UnitFileEnabledRuntime: "enabled-runtime",
+	UnitFileLinked:         "linked",
+	UnitFileLinkedRuntime:  "linked-runtime",
+	UnitFileAlias:          "alias",
+	UnitFileMasked:         "masked",
+	UnitFileMaskedRuntime:  "masked-runtime",
+	UnitFileStatic:         "static",
+	UnitFileIndirect:       "indirect",
+	UnitFileDisabled:       "disabled",
+	UnitFileGenerated:      "generated",
+	UnitFileTransient:      "transient",
+	UnitFileBad:            "bad",
+}
+
+// ParseUnitFileState maps a state string reported by systemd to a
+// UnitFileState. Unrecognized states map to UnitFileUnknown.
+func ParseUnitFileState(state string) UnitFileState {
+	for i, name := range unitFileStateNames {
+		if name == state {
+			return UnitFileState(i)
+		}
+	}
+	return UnitFileUnknown
+}
+
+// Enabled reports whether systemctl is-enabled succeeds for the state: the
+// unit is enabled, or is pulled in some other way and cannot be disabled.
+func (st UnitFileState) Enabled() bool {
+	switch st {
+	case UnitFileEnabled, UnitFileEnabledRuntime, UnitFileAlias, UnitFileStatic,
+		UnitFileIndirect, UnitFileGenerated, UnitFileTransient:
+		return true
+	}
+	return false
+}
+
+func (st UnitFileState) String() string {
+	if st < 0 || int(st) >= len(unitFileStateNames) {
+		return unitFileStateNames[UnitFileUnknown]
+	}
+	return unitFileStateNames[st]
+}
@@ -0,0 +1,394 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ValidationError lists every problem Config.Validate found.
+type ValidationError []error
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Validate checks that the Config is complete and its fields and options are
+// consistent, as Install does before writing anything. It returns a
+// ValidationError listing every problem found, or nil.
+func (c *Config) Validate() error {
+	var errs ValidationError
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(c.Name) == 0 {
+		check(ErrNameFieldRequired)
+	} else if c.Name == "." || c.Name == ".." || strings.ContainsAny(c.Name, "/\\") ||
+		strings.IndexFunc(c.Name, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		check(fmt.Errorf("Invalid Name %q, want no path separator, space or control character", c.Name))
+	}
+	check(checkArguments(c.Arguments))
+	check(checkArguments(c.ExecStop))
+	names := make([]string, 0, len(c.EnvVars))
+	for name := range c.EnvVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !validEnvName(name) {
+			check(fmt.Errorf("Invalid environment variable name %q", name))
+		}
+	}
+	for _, unit := range c.Conflicts {
+		if len(unit) == 0 || strings.IndexFunc(unit, unicode.IsSpace) >= 0 {
+			check(fmt.Errorf("Invalid conflicting unit %q", unit))
+		}
+	}
+	for _, unit := range c.Before {
+		if len(unit) == 0 || strings.IndexFunc(unit, unicode.IsSpace) >= 0 {
+			check(fmt.Errorf("Invalid unit %q in Before", unit))
+		}
+	}
+	fdNames := make(map[string]bool)
+	for i, socket := range c.Sockets {
+		if len(socket.ListenStream) == 0 || strings.IndexFunc(socket.ListenStream, unicode.IsSpace) >= 0 {
+			check(fmt.Errorf("Invalid ListenStream %q of socket %d", socket.ListenStream, i))
+		}
+		name := socket.FileDescriptorName
+		if len(name) == 0 {
+			continue
+		}
+		if len(name) > 255 || strings.ContainsAny(name, ":") || strings.IndexFunc(name, func(r rune) bool {
+			return r <= ' ' || r > '~'
+		}) >= 0 {
+			check(fmt.Errorf("Invalid FileDescriptorName %q of socket %d", name, i))
+		}
+		if fdNames[name] {
+			check(fmt.Errorf("Duplicate FileDescriptorName %q", name))
+		}
+		fdNames[name] = true
+	}
+	if syntax := c.Option.string(optionShellSyntax, ""); len(syntax) != 0 {
+		if !c.Option.bool(optionShellWrap, optionShellWrapDefault) {
+			check(fmt.Errorf("%s requires the %s option", optionShellSyntax, optionShellWrap))
+		}
+		if strings.ContainsAny(syntax, "\r\n") {
+			check(fmt.Errorf("%s contains a line break", optionShellSyntax))
+		}
+	}
+	if strings.ContainsAny(c.WorkingDirectory, "\r\n") {
+		check(fmt.Errorf("WorkingDirectory %q contains a line break", c.WorkingDirectory))
+	}
+	if title := c.Option.string(optionProcessTitle, ""); strings.IndexFunc(title, unicode.IsSpace) >= 0 ||
+		strings.IndexFunc(title, unicode.IsControl) >= 0 {
+		check(fmt.Errorf("%s %q contains a space or control character", optionProcessTitle, title))
+	}
+	for _, uri := range c.Documentation {
+		if len(uri) == 0 || strings.ContainsAny(uri, " \t\r\n") {
+			check(fmt.Errorf("Invalid documentation URI %q", uri))
+		}
+	}
+
+	check(checkOneOf(c.Option, optionServiceType,
+		"simple", "exec", "forking", "oneshot", "dbus", "notify", "notify-reload", "idle"))
+	switch serviceType(c.Option) {
+	case "forking":
+		if len(c.Option.string(optionPIDFile, "")) == 0 {
+			check(fmt.Errorf("Type=forking requires %s", optionPIDFile))
+		}
+	case "dbus":
+		if len(c.Option.string(optionBusName, "")) == 0 &&
+			!hasPrefix(c.Option.stringSlice(optionServiceRaw, nil), "BusName=") {
+			check(fmt.Errorf("Type=dbus requires the %s option or a BusName= line in ServiceRaw", optionBusName))
+		}
+	}
+	if name := c.Option.string(optionBusName, ""); len(name) != 0 {
+		if !validBusName(name) {
+			check(fmt.Errorf("Invalid %s %q", optionBusName, name))
+		}
+		if t := serviceType(c.Option); t != "dbus" {
+			check(fmt.Errorf("%s requires Type=dbus, not %s", optionBusName, t))
+		}
+	}
+	if len(c.ExecStartExtra) != 0 && serviceType(c.Option) != "oneshot" {
+		check(fmt.Errorf("ExecStartExtra requires the oneshot service %s", optionServiceType))
+	}
+	for _, command := range c.ExecStartExtra {
+		if len(command) == 0 {
+			check(fmt.Errorf("ExecStartExtra contains an empty command"))
+		}
+		check(checkArguments(command))
+	}
+
+	_, err := reloadSignal(c.Option)
+	check(err)
+	check(checkOneOf(c.Option, optionRestart,
+		"no", "on-success", "on-failure", "on-abnormal", "on-watchdog", "on-abort", "always"))
+	if c.Restart == RestartDefault && c.Option.string(optionRestart, "") == "on-watchdog" &&
+		len(c.Option.string(optionWatchdogSec, "")) == 0 {
+		check(fmt.Errorf("Restart=on-watchdog requires the %s option", optionWatchdogSec))
+	}
+	if v, found := c.Option[optionOOMScoreAdjust]; found {
+		if adj, is := v.(int); !is || adj < -1000 || adj > 1000 {
+			check(fmt.Errorf("%s %v is not an int within -1000..1000", optionOOMScoreAdjust, v))
+		}
+	}
+	if v, found := c.Option[optionUMask]; found {
+		s, is := v.(string)
+		if mask, err := strconv.ParseUint(s, 8, 32); !is || err != nil || mask > 0777 {
+			check(fmt.Errorf("%s %q is not an octal mask within 000..777", optionUMask, v))
+		}
+	}
+	if wait := c.Option.string(optionRestartWait, ""); len(wait) != 0 {
+		if _, err := time.ParseDuration(wait); err != nil {
+			check(fmt.Errorf("%s: %v", optionRestartWait, err))
+		}
+	}
+	for _, path := range c.Option.stringSlice(optionRequiresMountsFor, nil) {
+		if !filepath.IsAbs(path) {
+			check(fmt.Errorf("%s path %q is not absolute", optionRequiresMountsFor, path))
+		}
+	}
+	for _, name := range []string{optionSELinuxContext, optionAppArmorProfile} {
+		if strings.ContainsAny(c.Option.string(name, ""), "\r\n") {
+			check(fmt.Errorf("%s contains a line break", name))
+		}
+	}
+	check(checkCapabilities(optionAmbientCapabilities, c.Option.stringSlice(optionAmbientCapabilities, nil)))
+	bounding := c.Option.stringSlice(optionCapabilityBoundingSet, nil)
+	if len(bounding) != 0 {
+		bounding = append([]string{strings.TrimPrefix(bounding[0], "~")}, bounding[1:]...)
+	}
+	check(checkCapabilities(optionCapabilityBoundingSet, bounding))
+	check(checkOneOf(c.Option, optionKillMode, "control-group", "process", "mixed", "none"))
+	check(checkOneOf(c.Option, optionHardeningProfile, "none", "basic", "strict"))
+	check(checkExitStatus(c.Option.string(optionSuccessExitStatus, "")))
+	if slice := c.Option.string(optionSlice, ""); len(slice) != 0 &&
+		(!strings.HasSuffix(slice, ".slice") || strings.IndexFunc(slice, unicode.IsSpace) >= 0) {
+		check(fmt.Errorf("Invalid %s %q, want a NAME.slice unit", optionSlice, slice))
+	}
+	if v, found := c.Option[optionTasksMax]; found {
+		if n, is := v.(int); !(is && n > 0 || v == "infinity") {
+			check(fmt.Errorf("%s %v is not a positive int or infinity", optionTasksMax, v))
+		}
+	}
+	for _, path := range c.Option.stringSlice(optionAssertPathExists, nil) {
+		if !filepath.IsAbs(strings.TrimPrefix(path, "!")) {
+			check(fmt.Errorf("%s path %q is not absolute", optionAssertPathExists, path))
+		}
+	}
+	for _, name := range []string{optionStartOn, optionStopOn} {
+		if v, found := c.Option[name]; found {
+			if s, is := v.(string); !is || len(strings.TrimSpace(s)) == 0 || strings.ContainsAny(s, "\r\n") {
+				check(fmt.Errorf("%s %q must be a single line of events", name, v))
+			}
+		}
+	}
+	check(checkOneOf(c.Option, optionExpect, "fork", "daemon", "stop"))
+	if v, found := c.Option[optionRespawnCount]; found {
+		if n, is := v.(int); !(is && n >= 0 || v == "unlimited") {
+			check(fmt.Errorf("%s %v is not a non-negative int or unlimited", optionRespawnCount, v))
+		}
+	}
+	if v, found := c.Option[optionRespawnInterval]; found {
+		if n, is := v.(int); !is || n < 0 {
+			check(fmt.Errorf("%s %v is not a non-negative int", optionRespawnInterval, v))
+		}
+	}
+
+	if len(c.ChRoot) != 0 {
+		if path, err := c.execPath(); err != nil {
+			check(err)
+		} else {
+			check(checkChRoot(c, path))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// serviceType returns the systemd Type option, which defaults to dbus when
+// the BusName option is set.
+func serviceType(kv KeyValue) string {
+	if t := kv.string(optionServiceType, ""); len(t) != 0 {
+		return t
+	}
+	if len(kv.string(optionBusName, "")) != 0 {
+		return "dbus"
+	}
+	return ""
+}
+
+// validEnvName reports whether name is a portable environment variable name:
+// a letter or '_' followed by letters, digits and '_'. The name is written
+// unquoted into shell scripts and Upstart jobs.
+func validEnvName(name string) bool {
+	for i, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_' || i > 0 && r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return len(name) != 0
+}
+
+// validBusName reports whether name is a well-known D-Bus name: at least two
+// dot separated elements of letters, digits, '_' and '-', none starting with
+// a digit.
+func validBusName(name string) bool {
+	elems := strings.Split(name, ".")
+	if len(name) > 255 || len(elems) < 2 {
+		return false
+	}
+	for _, elem := range elems {
+		if len(elem) == 0 || elem[0] >= '0' && elem[0] <= '9' {
+			return false
+		}
+		for _, r := range elem {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hasPrefix reports whether any of lines starts with prefix.
+func hasPrefix(lines []string, prefix string) bool {
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOneOf returns an error if the option name is set to a value not in
+// values.
+func checkOneOf(kv KeyValue, name string, values ...string) error {
+	v := kv.string(name, "")
+	if len(v) == 0 {
+		return nil
+	}
+	for _, value := range values {
+		if v == value {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown %s %q, want one of %s", name, v, strings.Join(values, ", "))
+}
+
+// exitSignals are the signal names accepted in SuccessExitStatus.
+var exitSignals = map[string]bool{
+	"HUP": true, "INT": true, "QUIT": true, "ILL": true, "TRAP": true,
+	"ABRT": true, "BUS": true, "FPE": true, "KILL": true, "USR1": true,
+	"SEGV": true, "USR2": true, "PIPE": true, "ALRM": true, "TERM": true,
+}
+
+// checkExitStatus returns an error naming the first entry of the space
+// separated status list that is neither an exit code nor a signal name.
+func checkExitStatus(status string) error {
+	for _, v := range strings.Fields(status) {
+		if code, err := strconv.Atoi(v); err == nil && code >= 0 && code <= 255 {
+			continue
+		}
+		if exitSignals[strings.TrimPrefix(v, "SIG")] {
+			continue
+		}
+		return fmt.Errorf("Invalid exit status %q in %s", v, optionSuccessExitStatus)
+	}
+	return nil
+}
+
+// capabilities are the Linux capability names, as listed in capabilities(7).
+var capabilities = map[string]bool{
+	"CAP_AUDIT_CONTROL": true, "CAP_AUDIT_READ": true, "CAP_AUDIT_WRITE": true,
+	"CAP_BLOCK_SUSPEND": true, "CAP_BPF": true, "CAP_CHECKPOINT_RESTORE": true,
+	"CAP_CHOWN": true, "CAP_DAC_OVERRIDE": true, "CAP_DAC_READ_SEARCH": true,
+	"CAP_FOWNER": true, "CAP_FSETID": true, "CAP_IPC_LOCK": true,
+	"CAP_IPC_OWNER": true, "CAP_KILL": true, "CAP_LEASE": true,
+	"CAP_LINUX_IMMUTABLE": true, "CAP_MAC_ADMIN": true, "CAP_MAC_OVERRIDE": true,
+	"CAP_MKNOD": true, "CAP_NET_ADMIN": true, "CAP_NET_BIND_SERVICE": true,
+	"CAP_NET_BROADCAST": true, "CAP_NET_RAW": true, "CAP_PERFMON": true,
+	"CAP_SETFCAP": true, "CAP_SETGID": true, "CAP_SETPCAP": true,
+	"CAP_SETUID": true, "CAP_SYS_ADMIN": true, "CAP_SYS_BOOT": true,
+	"CAP_SYS_CHROOT": true, "CAP_SYS_MODULE": true, "CAP_SYS_NICE": true,
+	"CAP_SYS_PACCT": true, "CAP_SYS_PTRACE": true, "CAP_SYS_RAWIO": true,
+	"CAP_SYS_RESOURCE": true, "CAP_SYS_TIME": true, "CAP_SYS_TTY_CONFIG": true,
+	"CAP_SYSLOG": true, "CAP_WAKE_ALARM": true,
+}
+
+// checkCapabilities returns an error naming the first of caps that is not a
+// known capability.
+func checkCapabilities(option string, caps []string) error {
+	for _, c := range caps {
+		if !capabilities[c] {
+			return fmt.Errorf("Unknown capability %q in %s", c, option)
+		}
+	}
+	return nil
+}
+
+// checkArguments returns an error if an argument contains a control character
+// that cannot be represented on the single command line of an init script.
+func checkArguments(args []string) error {
+	for i, arg := range args {
+		for _, r := range arg {
+			if r != '\t' && unicode.IsControl(r) {
+				return fmt.Errorf("Argument %d %q contains control character %q", i, arg, r)
+			}
+		}
+	}
+	return nil
+}
+
+// checkChRoot returns an error if c runs in a ChRoot that does not contain the
+// executable at path, unless the SkipPathCheck option is set. The path is
+// resolved inside the chroot before privileges are dropped to UserName.
+func checkChRoot(c *Config, path string) error {
+	if len(c.ChRoot) == 0 || c.Option.bool(optionSkipPathCheck, optionSkipPathCheckDefault) {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(c.ChRoot, path)); err != nil {
+		return fmt.Errorf("Executable %s not found in ChRoot %s: %v", path, c.ChRoot, err)
+	}
+	return nil
+}
+
+// reloadSignals are the signals accepted by the ReloadSignal option.
+var reloadSignals = map[string]bool{
+	"HUP": true, "INT": true, "QUIT": true, "USR1": true, "USR2": true,
+	"ALRM": true, "TERM": true, "CONT": true, "WINCH": true,
+}
+
+// reloadSignal returns the ReloadSignal option without its "SIG" prefix, or
+// an error if it does not name a known signal.
+func reloadSignal(kv KeyValue) (string, error) {
+	sig := kv.string(optionReloadSignal, "")
+	if len(sig) == 0 {
+		return "", nil
+	}
+	name := strings.TrimPrefix(strings.ToUpper(sig), "SIG")
+	if !reloadSignals[name] {
+		return "", fmt.Errorf("Unknown %s %q", optionReloadSignal, sig)
+	}
+	return name, nil
+}
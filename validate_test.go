@@ -0,0 +1,149 @@
+// Copyright 2015 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	c := &Config{Name: "go_service_test", Arguments: []string{"-v"}}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate = %v, want nil", err)
+	}
+
+	c = &Config{
+		Arguments:      []string{"a\nb"},
+		Documentation:  []string{"man:app(1) extra"},
+		ExecStartExtra: [][]string{{}},
+		Option: KeyValue{
+			optionKillMode:              "all",
+			optionOOMScoreAdjust:        2000,
+			optionAmbientCapabilities:   []string{"CAP_NET_BIND_SERVICE", "CAP_FLY"},
+			optionCapabilityBoundingSet: []string{"~CAP_SYS_ADMIN", "CAP_KILL"},
+			optionReloadSignal:          "SIGFOO",
+		},
+	}
+	err := c.Validate()
+	errs, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("Validate = %v, want a ValidationError", err)
+	}
+	// Name, Arguments, Documentation, ExecStartExtra Type and empty command,
+	// ReloadSignal, OOMScoreAdjust, AmbientCapabilities and KillMode.
+	if len(errs) != 9 {
+		t.Errorf("Validate found %d problems, want 9:\n%v", len(errs), err)
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"go_service_test", true},
+		{"app@", true},
+		{"app.v2", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../x", false},
+		{"etc/app", false},
+		{`app\x`, false},
+		{"my app", false},
+		{"app\n", false},
+		{"app\x00", false},
+	}
+	for _, tt := range tests {
+		c := &Config{Name: tt.name}
+		if err := c.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate with Name %q = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateEnvVars(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"APP_DIR", true},
+		{"_private2", true},
+		{"", false},
+		{"2FAST", false},
+		{"APP-DIR", false},
+		{"A B", false},
+		{"X;id>/tmp/p;Y", false},
+		{"$(id)", false},
+	}
+	for _, tt := range tests {
+		c := &Config{Name: "go_service_test", EnvVars: map[string]string{tt.name: "value"}}
+		if err := c.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate with EnvVars name %q = %v, want valid %v", tt.name, err, tt.valid)
+		}
+		if _, err := RenderUpstart(&Config{Name: "go_service_test", Executable: "/bin/true", EnvVars: c.EnvVars}); (err == nil) != tt.valid {
+			t.Errorf("RenderUpstart with EnvVars name %q = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	tests := []struct {
+		option KeyValue
+		valid  bool
+	}{
+		{KeyValue{}, true},
+		{KeyValue{optionServiceType: "notify"}, true},
+		{KeyValue{optionServiceType: "daemon"}, false},
+		{KeyValue{optionServiceType: "forking"}, false},
+		{KeyValue{optionServiceType: "forking", optionPIDFile: "/run/app.pid"}, true},
+		{KeyValue{optionServiceType: "dbus"}, false},
+		{KeyValue{optionServiceType: "dbus", optionServiceRaw: []string{"BusName=org.example.App"}}, true},
+		{KeyValue{optionBusName: "org.example.App"}, true},
+		{KeyValue{optionBusName: "org.example.App", optionServiceType: "notify"}, false},
+		{KeyValue{optionBusName: "org.2example.App"}, false},
+		{KeyValue{optionBusName: "example"}, false},
+		{KeyValue{optionRestart: "on-abnormal"}, true},
+		{KeyValue{optionRestart: "sometimes"}, false},
+		{KeyValue{optionTasksMax: 64}, true},
+		{KeyValue{optionTasksMax: "infinity"}, true},
+		{KeyValue{optionTasksMax: 0}, false},
+		{KeyValue{optionTasksMax: "64"}, false},
+		{KeyValue{optionRespawnCount: 3, optionRespawnInterval: 60}, true},
+		{KeyValue{optionRespawnCount: "unlimited"}, true},
+		{KeyValue{optionRespawnCount: "ten"}, false},
+		{KeyValue{optionRespawnCount: -1}, false},
+		{KeyValue{optionRespawnInterval: "5s"}, false},
+		{KeyValue{optionSlice: "app.slice"}, true},
+		{KeyValue{optionSlice: "app"}, false},
+		{KeyValue{optionHardeningProfile: "strict"}, true},
+		{KeyValue{optionHardeningProfile: "paranoid"}, false},
+		{KeyValue{optionShellSyntax: "| logger"}, false},
+		{KeyValue{optionShellWrap: true, optionShellSyntax: "| logger"}, true},
+		{KeyValue{optionUMask: "0027"}, true},
+		{KeyValue{optionUMask: "089"}, false},
+		{KeyValue{optionUMask: "1777"}, false},
+	}
+	for _, tt := range tests {
+		c := &Config{Name: "go_service_test", Option: tt.option}
+		if err := c.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%v) = %v, want valid %v", tt.option, err, tt.valid)
+		}
+	}
+}
+
+func TestCheckExitStatus(t *testing.T) {
+	for status, valid := range map[string]bool{
+		"":            true,
+		"3":           true,
+		"0 3 SIGUSR1": true,
+		"TERM":        true,
+		"256":         false,
+		"-1":          false,
+		"SIGFOO":      false,
+	} {
+		if err := checkExitStatus(status); (err == nil) != valid {
+			t.Errorf("checkExitStatus(%q) = %v, want valid %v", status, err, valid)
+		}
+	}
+}